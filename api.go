@@ -3,11 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func (s *Server) handleRegister(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -36,6 +39,80 @@ func (s *Server) handleRegister(ctx context.Context, w http.ResponseWriter, r *h
 		StatusCode: http.StatusOK,
 		Msg:        "user successfully registered",
 		ID:         id,
+		Card:       user.Accounts[0].Cards[0],
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleLogin(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	req := new(LoginRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	if errors := req.ValidateLogin(); len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	user, err := s.store.UserByPhoneNumber(ctx, req.PhoneNumber)
+	if err != nil {
+		if _, ok := err.(APIError); ok {
+			return InvalidCredentials()
+		}
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return InvalidCredentials()
+	}
+
+	access, refresh, err := s.tokens.IssuePair(user.ID, user.Role)
+	if err != nil {
+		return err
+	}
+
+	resp := TokenResponse{
+		StatusCode:   http.StatusOK,
+		AccessToken:  access,
+		RefreshToken: refresh,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleRefresh(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	req := new(RefreshRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	claims, err := s.tokens.Parse(req.RefreshToken, refreshToken)
+	if err != nil {
+		return Unauthorized()
+	}
+
+	user, err := s.store.UserByID(ctx, claims.UserID)
+	if err != nil {
+		if _, ok := err.(APIError); ok {
+			return Unauthorized()
+		}
+		return err
+	}
+
+	access, refresh, err := s.tokens.IssuePair(user.ID, user.Role)
+	if err != nil {
+		return err
+	}
+
+	resp := TokenResponse{
+		StatusCode:   http.StatusOK,
+		AccessToken:  access,
+		RefreshToken: refresh,
 	}
 
 	return writeJSON(w, http.StatusOK, resp)
@@ -45,92 +122,1013 @@ func (s *Server) handleTransaction(ctx context.Context, w http.ResponseWriter, r
 	req := new(TransactionRequest)
 
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		if errors.Is(err, errInvalidAmount) || errors.Is(err, errAmountPrecision) {
+			return InvalidRequestData(map[string]string{"amount": err.Error()})
+		}
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	req.UserID, _ = userIDFromContext(ctx)
+	req.IdempotencyKey = r.Header.Get("Idempotency-Key")
+
+	errors := req.ValidateTransaction()
+	if err := s.allowLegacyCardNumbers(ctx, errors, map[string]string{"fromCardNumber": req.FromCardNumber, "toCardNumber": req.ToCardNumber}); err != nil {
+		return err
+	}
+
+	if len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	if err := s.resolveAccounts(ctx, req); err != nil {
+		return err
+	}
+
+	if req.ExecuteAt != nil {
+		if err := s.authorizeCard(ctx, req.FromCardNumber); err != nil {
+			return err
+		}
+
+		scheduled, err := s.store.ScheduleTransfer(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		if req.FromCardToken != "" {
+			scheduled.FromCardNumber = req.FromCardToken
+		}
+		if req.ToCardToken != "" {
+			scheduled.ToCardNumber = req.ToCardToken
+		}
+
+		resp := ScheduledTransferResponse{
+			StatusCode:        http.StatusAccepted,
+			Msg:               "transfer scheduled",
+			ScheduledTransfer: scheduled,
+		}
+
+		return writeJSON(w, http.StatusAccepted, resp)
+	}
+
+	if req.Type == depositTransaction {
+		transaction, err := s.store.Deposit(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		resp := TransactionResponse{
+			StatusCode:  http.StatusCreated,
+			Msg:         "successful transaction",
+			Transaction: req.tokenized(transaction),
+		}
+
+		return writeJSON(w, http.StatusCreated, resp)
+	}
+
+	if req.Type == transferTransaction {
+		if err := s.authorizeCard(ctx, req.FromCardNumber); err != nil {
+			return err
+		}
+
+		transaction, err := s.store.Transfer(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		resp := TransactionResponse{
+			StatusCode:  http.StatusCreated,
+			Msg:         "successful transaction",
+			Transaction: req.tokenized(transaction),
+		}
+
+		return writeJSON(w, http.StatusCreated, resp)
+	}
+
+	if req.Type == withdrawalTransaction {
+		if err := s.authorizeCard(ctx, req.FromCardNumber); err != nil {
+			return err
+		}
+
+		transaction, err := s.store.Withdraw(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		resp := TransactionResponse{
+			StatusCode:  http.StatusCreated,
+			Msg:         "successful transaction",
+			Transaction: req.tokenized(transaction),
+		}
+
+		return writeJSON(w, http.StatusCreated, resp)
+	}
+
+	return writeJSON(w, http.StatusBadRequest, nil)
+}
+
+func (s *Server) handleReverseTransaction(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := parseUUID(r)
+	if err != nil {
+		return InvalidTransactionID()
+	}
+
+	req := &ReversalRequest{TransactionID: id}
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil && !errors.Is(err, io.EOF) {
+		if errors.Is(err, errInvalidAmount) || errors.Is(err, errAmountPrecision) {
+			return InvalidRequestData(map[string]string{"amount": err.Error()})
+		}
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	if errors := req.ValidateReversal(); len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	transaction, err := s.store.Reverse(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	resp := TransactionResponse{
+		StatusCode:  http.StatusCreated,
+		Msg:         "successful reversal",
+		Transaction: transaction,
+	}
+
+	return writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) handlePlaceHold(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	req := new(HoldRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		if errors.Is(err, errInvalidAmount) || errors.Is(err, errAmountPrecision) {
+			return InvalidRequestData(map[string]string{"amount": err.Error()})
+		}
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	errors := req.ValidateHold()
+	if err := s.allowLegacyCardNumbers(ctx, errors, map[string]string{"cardNumber": req.CardNumber, "merchantCardNumber": req.MerchantCardNumber}); err != nil {
+		return err
+	}
+
+	if len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	if err := s.authorizeCard(ctx, req.MerchantCardNumber); err != nil {
+		return err
+	}
+
+	hold, err := s.store.PlaceHold(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	resp := HoldResponse{
+		StatusCode: http.StatusCreated,
+		Msg:        "hold placed",
+		Hold:       hold.Masked(),
+	}
+
+	return writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) handleCaptureHold(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := parseUUID(r)
+	if err != nil {
+		return InvalidHoldID()
+	}
+
+	req := &CaptureRequest{HoldID: id}
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil && !errors.Is(err, io.EOF) {
+		if errors.Is(err, errInvalidAmount) || errors.Is(err, errAmountPrecision) {
+			return InvalidRequestData(map[string]string{"amount": err.Error()})
+		}
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	if errors := req.ValidateCapture(); len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	if err := s.authorizeHold(ctx, id); err != nil {
+		return err
+	}
+
+	transaction, err := s.store.CaptureHold(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	resp := TransactionResponse{
+		StatusCode:  http.StatusCreated,
+		Msg:         "hold captured",
+		Transaction: transaction,
+	}
+
+	return writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) handleReleaseHold(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := parseUUID(r)
+	if err != nil {
+		return InvalidHoldID()
+	}
+
+	if err := s.authorizeHold(ctx, id); err != nil {
+		return err
+	}
+
+	hold, err := s.store.ReleaseHold(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	resp := HoldResponse{
+		StatusCode: http.StatusOK,
+		Msg:        "hold released",
+		Hold:       hold.Masked(),
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetScheduledTransfer(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := parseUUID(r)
+	if err != nil {
+		return InvalidScheduledTransferID()
+	}
+
+	scheduled, err := s.store.ScheduledTransferByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := authorizeUser(ctx, scheduled.UserID); err != nil {
+		return err
+	}
+
+	resp := ScheduledTransferResponse{
+		StatusCode:        http.StatusOK,
+		Msg:               "scheduled transfer",
+		ScheduledTransfer: scheduled,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCancelScheduledTransfer(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := parseUUID(r)
+	if err != nil {
+		return InvalidScheduledTransferID()
+	}
+
+	scheduled, err := s.store.ScheduledTransferByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := authorizeUser(ctx, scheduled.UserID); err != nil {
+		return err
+	}
+
+	scheduled, err = s.store.CancelScheduledTransfer(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	resp := ScheduledTransferResponse{
+		StatusCode:        http.StatusOK,
+		Msg:               "scheduled transfer cancelled",
+		ScheduledTransfer: scheduled,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCreateStandingOrder(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	req := new(StandingOrderRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		if errors.Is(err, errInvalidAmount) || errors.Is(err, errAmountPrecision) {
+			return InvalidRequestData(map[string]string{"amount": err.Error()})
+		}
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	req.UserID, _ = userIDFromContext(ctx)
+
+	errors := req.ValidateStandingOrder()
+	if err := s.allowLegacyCardNumbers(ctx, errors, map[string]string{"fromCardNumber": req.FromCardNumber, "toCardNumber": req.ToCardNumber}); err != nil {
+		return err
+	}
+
+	if len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	if err := s.authorizeCard(ctx, req.FromCardNumber); err != nil {
+		return err
+	}
+
+	order := NewStandingOrder(req)
+
+	if err := s.store.CreateStandingOrder(ctx, &order); err != nil {
+		return err
+	}
+
+	resp := StandingOrderResponse{
+		StatusCode:    http.StatusCreated,
+		Msg:           "standing order created",
+		StandingOrder: order,
+	}
+
+	return writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) handleGetStandingOrders(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	userID, ok := userIDFromContext(ctx)
+	if !ok {
+		return Unauthorized()
+	}
+
+	orders, err := s.store.StandingOrdersByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for i := range orders {
+		orders[i] = orders[i].Masked()
+	}
+
+	resp := StandingOrdersResponse{
+		StatusCode:     http.StatusOK,
+		StandingOrders: orders,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetStandingOrder(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	order, err := s.ownStandingOrder(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	resp := StandingOrderResponse{
+		StatusCode:    http.StatusOK,
+		Msg:           "standing order",
+		StandingOrder: order,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleUpdateStandingOrder(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	order, err := s.ownStandingOrder(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	req := &StandingOrderUpdate{ID: order.ID}
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		if errors.Is(err, errInvalidAmount) || errors.Is(err, errAmountPrecision) {
+			return InvalidRequestData(map[string]string{"amount": err.Error()})
+		}
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	if errors := req.ValidateStandingOrderUpdate(order.StartAt); len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	order, err = s.store.UpdateStandingOrder(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	resp := StandingOrderResponse{
+		StatusCode:    http.StatusOK,
+		Msg:           "standing order updated",
+		StandingOrder: order,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCancelStandingOrder(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	order, err := s.ownStandingOrder(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	order, err = s.store.CancelStandingOrder(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	resp := StandingOrderResponse{
+		StatusCode:    http.StatusOK,
+		Msg:           "standing order cancelled",
+		StandingOrder: order,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetStandingOrderRuns(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	order, err := s.ownStandingOrder(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	runs, err := s.store.StandingOrderRuns(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	resp := StandingOrderRunsResponse{
+		StatusCode:      http.StatusOK,
+		StandingOrderID: order.ID,
+		Runs:            runs,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleOpenAccount(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := parseID(r)
+	if err != nil {
+		return InvalidID()
+	}
+
+	if err := authorizeUser(ctx, id); err != nil {
+		return err
+	}
+
+	req := new(NewAccountRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	if errors := req.ValidateAccount(); len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	currency := req.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+
+	account := NewAccount(req.Type, currency)
+
+	if err := s.store.OpenAccount(ctx, id, &account); err != nil {
+		return err
+	}
+
+	resp := AccountResponse{
+		StatusCode: http.StatusCreated,
+		Msg:        "account opened",
+		Account:    account,
+	}
+
+	return writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) handleIssueCard(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	account, err := s.ownAccount(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	req := new(NewCardRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	if errors := req.ValidateCard(); len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	card := NewCard()
+	card.Kind = req.Kind
+
+	if err := s.store.IssueCard(ctx, account.ID, &card); err != nil {
+		return err
+	}
+
+	resp := CardResponse{
+		StatusCode: http.StatusCreated,
+		Msg:        "card issued",
+		Card:       card,
+	}
+
+	return writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) handleGetCards(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	account, err := s.ownAccount(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	cards, err := s.store.CardsByAccount(ctx, account.ID)
+	if err != nil {
+		return err
+	}
+
+	resp := CardsResponse{
+		StatusCode: http.StatusOK,
+		AccountID:  account.ID,
+		Cards:      maskCards(cards),
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleFreezeCard(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return s.changeCardStatus(ctx, w, r, []string{cardActive}, cardFrozen, "card frozen")
+}
+
+func (s *Server) handleUnfreezeCard(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return s.changeCardStatus(ctx, w, r, []string{cardFrozen}, cardActive, "card unfrozen")
+}
+
+func (s *Server) handleBlockCard(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return s.changeCardStatus(ctx, w, r, []string{cardActive, cardFrozen}, cardBlocked, "card blocked")
+}
+
+func (s *Server) handleReplaceCard(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	card, err := s.ownCard(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	replacement := NewCard()
+
+	if err := s.store.ReplaceCard(ctx, card.ID, &replacement); err != nil {
+		return err
+	}
+
+	resp := CardResponse{
+		StatusCode: http.StatusCreated,
+		Msg:        "card replaced",
+		Card:       replacement,
+	}
+
+	return writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleActivateCard gives a reissued card its CVV. The response is the only
+// place the CVV is ever shown.
+func (s *Server) handleActivateCard(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	card, err := s.ownCard(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	card.CVV = newCVV()
+
+	if err := s.store.ActivateCard(ctx, &card); err != nil {
+		return err
+	}
+
+	resp := CardResponse{
+		StatusCode: http.StatusOK,
+		Msg:        "card activated",
+		Card:       card,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleTokenizeCard(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	card, err := s.ownCard(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	token, err := s.store.TokenizeCard(ctx, card)
+	if err != nil {
+		return err
+	}
+
+	resp := CardTokenResponse{
+		StatusCode: http.StatusOK,
+		Msg:        "card tokenized",
+		Token:      token,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleDetokenize(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	req := new(DetokenizeRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	req.Token = chi.URLParam(r, "token")
+	req.UserID, _ = userIDFromContext(ctx)
+
+	if errors := req.ValidateDetokenize(); len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	card, err := s.store.Detokenize(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	resp := DetokenizeResponse{
+		StatusCode: http.StatusOK,
+		Token:      req.Token,
+		CardID:     card.ID,
+		CardNumber: card.Number,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetDetokenizations(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	detokenizations, err := s.store.Detokenizations(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp := DetokenizationsResponse{
+		StatusCode:      http.StatusOK,
+		Detokenizations: detokenizations,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleVerifyCard(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	req := new(CardVerificationRequest)
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	errors := req.ValidateCardVerification()
+	if err := s.allowLegacyCardNumbers(ctx, errors, map[string]string{"cardNumber": req.CardNumber}); err != nil {
+		return err
+	}
+
+	if len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	if err := s.store.VerifyCard(ctx, req); err != nil {
+		return err
+	}
+
+	resp := CardVerificationResponse{
+		StatusCode: http.StatusOK,
+		Msg:        "card verified",
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) changeCardStatus(ctx context.Context, w http.ResponseWriter, r *http.Request, from []string, status, msg string) error {
+	card, err := s.ownCard(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	card, err = s.store.UpdateCardStatus(ctx, card.ID, from, status)
+	if err != nil {
+		return err
+	}
+
+	resp := CardResponse{
+		StatusCode: http.StatusOK,
+		Msg:        msg,
+		Card:       card,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetNotifications(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := parseID(r)
+	if err != nil {
+		return InvalidID()
+	}
+
+	if err := authorizeUser(ctx, id); err != nil {
+		return err
+	}
+
+	notifications, err := s.store.NotificationsByUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	resp := NotificationsResponse{
+		StatusCode:    http.StatusOK,
+		UserID:        id,
+		Notifications: notifications,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetUserByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := parseID(r)
+	if err != nil {
+		return InvalidID()
+	}
+
+	if err := authorizeUser(ctx, id); err != nil {
+		return err
+	}
+
+	user, err := s.store.UserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	resp := UserResponse{
+		StatusCode: http.StatusOK,
+		User:       user.MaskedCards(),
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetTransactionsByUser(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := parseID(r)
+	if err != nil {
+		return InvalidID()
+	}
+
+	if err := authorizeUser(ctx, id); err != nil {
+		return err
+	}
+
+	transactions, err := s.store.TransactionsByUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// The history must not reveal card numbers the user only knows by token.
+	for i := range transactions {
+		transactions[i] = transactions[i].Masked()
+	}
+
+	resp := TransactionsResponse{
+		StatusCode:   http.StatusOK,
+		UserID:       id,
+		Transactions: transactions,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetUsers(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	users, err := s.store.Users(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range users {
+		users[i] = users[i].MaskedCards()
+	}
+
+	resp := UsersResponse{
+		StatusCode: http.StatusOK,
+		Users:      users,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetLimits(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := parseID(r)
+	if err != nil {
+		return InvalidAccountID()
+	}
+
+	limits, err := s.store.LimitsByAccount(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	resp := LimitsResponse{
+		StatusCode: http.StatusOK,
+		AccountID:  id,
+		Limits:     limits,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleUpdateLimits(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := parseID(r)
+	if err != nil {
+		return InvalidAccountID()
+	}
+
+	req := new(AccountLimits)
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		if errors.Is(err, errInvalidAmount) || errors.Is(err, errAmountPrecision) {
+			return InvalidRequestData(map[string]string{"limits": err.Error()})
+		}
 		return InvalidJSON()
 	}
 	defer r.Body.Close()
 
-	if errors := req.ValidateTransaction(); len(errors) > 0 {
+	if errors := req.ValidateLimits(); len(errors) > 0 {
 		return InvalidRequestData(errors)
 	}
 
-	if req.Type == depositTransaction {
-		transaction, err := s.store.Deposit(ctx, req)
-		if err != nil {
-			return err
-		}
+	limits, err := s.store.UpdateLimits(ctx, id, req)
+	if err != nil {
+		return err
+	}
 
-		resp := TransactionResponse{
-			StatusCode:  http.StatusCreated,
-			Msg:         "successful transaction",
-			Transaction: transaction,
-		}
+	resp := LimitsResponse{
+		StatusCode: http.StatusOK,
+		AccountID:  id,
+		Limits:     limits,
+	}
 
-		return writeJSON(w, http.StatusCreated, resp)
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGrantOverdraft(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := parseID(r)
+	if err != nil {
+		return InvalidAccountID()
 	}
 
-	if req.Type == transferTransaction {
-		transaction, err := s.store.Transfer(ctx, req)
-		if err != nil {
-			return err
-		}
+	req := new(OverdraftRequest)
 
-		resp := TransactionResponse{
-			StatusCode:  http.StatusCreated,
-			Msg:         "successful transaction",
-			Transaction: transaction,
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		if errors.Is(err, errInvalidAmount) || errors.Is(err, errAmountPrecision) {
+			return InvalidRequestData(map[string]string{"limit": err.Error()})
 		}
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
 
-		return writeJSON(w, http.StatusCreated, resp)
+	if errors := req.ValidateOverdraft(); len(errors) > 0 {
+		return InvalidRequestData(errors)
 	}
 
-	return writeJSON(w, http.StatusBadRequest, nil)
+	account, err := s.store.SetOverdraft(ctx, id, req.Limit)
+	if err != nil {
+		return err
+	}
+
+	resp := OverdraftResponse{
+		StatusCode:     http.StatusOK,
+		Msg:            "overdraft granted",
+		AccountID:      id,
+		OverdraftLimit: account.OverdraftLimit,
+		Currency:       account.Currency,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
 }
 
-func (s *Server) handleGetUserByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+func (s *Server) handleRevokeOverdraft(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	id, err := parseID(r)
 	if err != nil {
-		return InvalidID()
+		return InvalidAccountID()
 	}
 
-	user, err := s.store.UserByID(ctx, id)
+	account, err := s.store.SetOverdraft(ctx, id, 0)
 	if err != nil {
 		return err
 	}
 
-	resp := UserResponse{
-		StatusCode: http.StatusOK,
-		User:       user,
+	resp := OverdraftResponse{
+		StatusCode:     http.StatusOK,
+		Msg:            "overdraft revoked",
+		AccountID:      id,
+		OverdraftLimit: account.OverdraftLimit,
+		Currency:       account.Currency,
 	}
 
 	return writeJSON(w, http.StatusOK, resp)
 }
 
-func (s *Server) handleGetTransactionsByUser(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	id, err := parseID(r)
+func (s *Server) handleGetInterestRates(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	rates, err := s.store.InterestRates(ctx)
 	if err != nil {
-		return InvalidID()
+		return err
 	}
 
-	transactions, err := s.store.TransactionsByUser(ctx, id)
+	resp := InterestRatesResponse{
+		StatusCode:    http.StatusOK,
+		InterestRates: rates,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleSetInterestRate(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	req := new(InterestRate)
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	req.AccountType = chi.URLParam(r, "type")
+
+	if errors := req.ValidateInterestRate(); len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	rate, err := s.store.SetInterestRate(ctx, req)
 	if err != nil {
 		return err
 	}
 
-	resp := TransactionsResponse{
-		StatusCode:   http.StatusOK,
-		UserID:       id,
-		Transactions: transactions,
+	resp := InterestRatesResponse{
+		StatusCode:    http.StatusOK,
+		InterestRates: []InterestRate{rate},
 	}
 
 	return writeJSON(w, http.StatusOK, resp)
 }
 
-func (s *Server) handleGetUsers(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+func (s *Server) handleGetExchangeRates(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	rates, err := s.store.ExchangeRates(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp := ExchangeRatesResponse{
+		StatusCode:    http.StatusOK,
+		ExchangeRates: rates,
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleSetExchangeRate(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	req := new(ExchangeRate)
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return InvalidJSON()
+	}
+	defer r.Body.Close()
+
+	req.Base = chi.URLParam(r, "base")
+	req.Quote = chi.URLParam(r, "quote")
+
+	if errors := req.ValidateExchangeRate(); len(errors) > 0 {
+		return InvalidRequestData(errors)
+	}
+
+	rate, err := s.store.SetExchangeRate(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	resp := ExchangeRatesResponse{
+		StatusCode:    http.StatusOK,
+		ExchangeRates: []ExchangeRate{rate},
+	}
+
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetMaskedUsers(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	users, err := s.store.Users(ctx)
 	if err != nil {
 		return err
 	}
 
+	for i := range users {
+		users[i] = users[i].Masked()
+	}
+
 	resp := UsersResponse{
 		StatusCode: http.StatusOK,
 		Users:      users,
@@ -143,7 +1141,7 @@ type APIFunc func(context.Context, http.ResponseWriter, *http.Request) error
 
 func makeHTTPFunc(fn APIFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.WithValue(context.Background(), RequestID{}, uuid.New().String())
+		ctx := context.WithValue(r.Context(), RequestID{}, uuid.New().String())
 		if err := fn(ctx, w, r); err != nil {
 			if apiErr, ok := err.(APIError); ok {
 				writeJSON(w, apiErr.StatusCode, apiErr)
@@ -158,6 +1156,189 @@ func makeHTTPFunc(fn APIFunc) http.HandlerFunc {
 	}
 }
 
+// authorizeUser allows access only to the authenticated user's own data.
+func authorizeUser(ctx context.Context, id int) error {
+	callerID, ok := userIDFromContext(ctx)
+	if !ok {
+		return Unauthorized()
+	}
+
+	if callerID != id {
+		return Forbidden()
+	}
+
+	return nil
+}
+
+// allowLegacyCardNumbers clears the check digit errors of card numbers, keyed
+// by field, that belong to issued cards: cards issued before numbers carried
+// a Luhn check digit stay usable until they are replaced.
+func (s *Server) allowLegacyCardNumbers(ctx context.Context, errors map[string]string, cardNumbers map[string]string) error {
+	for field, cardNumber := range cardNumbers {
+		if errors[field] != invalidCheckDigit {
+			continue
+		}
+
+		exists, err := s.store.CardExists(ctx, cardNumber)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			delete(errors, field)
+		}
+	}
+
+	return nil
+}
+
+// authorizeCard allows debiting only cards owned by the authenticated user.
+func (s *Server) authorizeCard(ctx context.Context, cardNumber string) error {
+	ownerID, err := s.store.CardOwner(ctx, cardNumber)
+	if err != nil {
+		return err
+	}
+
+	return authorizeUser(ctx, ownerID)
+}
+
+// resolveAccounts replaces account IDs and card tokens in the request with
+// card numbers. Account IDs address only the authenticated user's own
+// accounts; tokens are checked like card numbers once resolved.
+func (s *Server) resolveAccounts(ctx context.Context, req *TransactionRequest) error {
+	if req.FromCardToken != "" {
+		card, err := s.store.CardByToken(ctx, req.FromCardToken)
+		if err != nil {
+			return err
+		}
+
+		req.FromCardNumber = card.Number
+	}
+
+	if req.ToCardToken != "" {
+		card, err := s.store.CardByToken(ctx, req.ToCardToken)
+		if err != nil {
+			return err
+		}
+
+		req.ToCardNumber = card.Number
+	}
+
+	if req.FromAccountID != 0 {
+		account, err := s.store.AccountByID(ctx, req.FromAccountID)
+		if err != nil {
+			return err
+		}
+
+		if err := authorizeUser(ctx, account.UserID); err != nil {
+			return err
+		}
+
+		card, ok := account.PrimaryCard()
+		if !ok {
+			return NoActiveCard(account.ID)
+		}
+
+		req.FromCardNumber = card.Number
+	}
+
+	if req.ToAccountID != 0 {
+		account, err := s.store.AccountByID(ctx, req.ToAccountID)
+		if err != nil {
+			return err
+		}
+
+		if err := authorizeUser(ctx, account.UserID); err != nil {
+			return err
+		}
+
+		card, ok := account.PrimaryCard()
+		if !ok {
+			return NoActiveCard(account.ID)
+		}
+
+		req.ToCardNumber = card.Number
+	}
+
+	return nil
+}
+
+// authorizeHold allows capturing or releasing only holds placed for the
+// authenticated user's merchant card.
+func (s *Server) authorizeHold(ctx context.Context, id uuid.UUID) error {
+	hold, err := s.store.HoldByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return s.authorizeCard(ctx, hold.MerchantCardNumber)
+}
+
+// ownAccount loads the account from the URL and checks that it belongs to
+// the authenticated user.
+func (s *Server) ownAccount(ctx context.Context, r *http.Request) (Account, error) {
+	id, err := parseID(r)
+	if err != nil {
+		return Account{}, InvalidAccountID()
+	}
+
+	account, err := s.store.AccountByID(ctx, id)
+	if err != nil {
+		return Account{}, err
+	}
+
+	if err := authorizeUser(ctx, account.UserID); err != nil {
+		return Account{}, err
+	}
+
+	return account, nil
+}
+
+// ownCard loads the card from the URL and checks that its account belongs to
+// the authenticated user.
+func (s *Server) ownCard(ctx context.Context, r *http.Request) (Card, error) {
+	id, err := parseID(r)
+	if err != nil {
+		return Card{}, InvalidCardID()
+	}
+
+	card, err := s.store.CardByID(ctx, id)
+	if err != nil {
+		return Card{}, err
+	}
+
+	account, err := s.store.AccountByID(ctx, card.AccountID)
+	if err != nil {
+		return Card{}, err
+	}
+
+	if err := authorizeUser(ctx, account.UserID); err != nil {
+		return Card{}, err
+	}
+
+	return card, nil
+}
+
+// ownStandingOrder loads the standing order from the URL and checks that it
+// belongs to the authenticated user.
+func (s *Server) ownStandingOrder(ctx context.Context, r *http.Request) (StandingOrder, error) {
+	id, err := parseUUID(r)
+	if err != nil {
+		return StandingOrder{}, InvalidStandingOrderID()
+	}
+
+	order, err := s.store.StandingOrderByID(ctx, id)
+	if err != nil {
+		return StandingOrder{}, err
+	}
+
+	if err := authorizeUser(ctx, order.UserID); err != nil {
+		return StandingOrder{}, err
+	}
+
+	return order, nil
+}
+
 func writeJSON(w http.ResponseWriter, s int, v any) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(s)
@@ -168,3 +1349,7 @@ func parseID(r *http.Request) (int, error) {
 	strID := chi.URLParam(r, "id")
 	return strconv.Atoi(strID)
 }
+
+func parseUUID(r *http.Request) (uuid.UUID, error) {
+	return uuid.Parse(chi.URLParam(r, "id"))
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/google/uuid"
 )
 
 type APIError struct {
@@ -34,15 +36,170 @@ func NoUser() APIError {
 }
 
 func NoAccount(cardNumber string) APIError {
-	return NewAPIError(http.StatusBadRequest, fmt.Errorf("account doesn't exist with card %s", cardNumber))
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("account doesn't exist with card %s", maskDigits(cardNumber)))
+}
+
+func InvalidAccountID() APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("invalid account ID"))
+}
+
+func NoAccountID(id int) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("account %d doesn't exist", id))
+}
+
+func NoActiveCard(accountID int) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("account %d has no active card", accountID))
+}
+
+func InvalidCardID() APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("invalid card ID"))
+}
+
+func NoCard(id int) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("card %d doesn't exist", id))
+}
+
+func CardNotActive(cardNumber, status string) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("card %s is %s", maskDigits(cardNumber), status))
+}
+
+func CardExpired(cardNumber string) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("card %s has expired", maskDigits(cardNumber)))
+}
+
+func NoCardToken() APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("card token doesn't exist"))
+}
+
+func CardVerificationFailed() APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("card verification failed"))
+}
+
+func CardAlreadyActivated(id int) APIError {
+	return NewAPIError(http.StatusConflict, fmt.Errorf("card %d is already activated", id))
+}
+
+func CardStatusConflict(status, target string) APIError {
+	return NewAPIError(http.StatusConflict, fmt.Errorf("card cannot become %s: status = %s", target, status))
 }
 
 func UserExists() APIError {
 	return NewAPIError(http.StatusBadRequest, fmt.Errorf("user already exists"))
 }
 
-func InsufficientFunds(balance, amount float64) APIError {
-	return NewAPIError(http.StatusBadRequest, fmt.Errorf("insufficient funds: balance = %.2f, amount = %.2f", balance, amount))
+func InvalidCredentials() APIError {
+	return NewAPIError(http.StatusUnauthorized, fmt.Errorf("invalid phone number or password"))
+}
+
+func Unauthorized() APIError {
+	return NewAPIError(http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+}
+
+func Forbidden() APIError {
+	return NewAPIError(http.StatusForbidden, fmt.Errorf("access denied"))
+}
+
+// InsufficientFunds reports the funds available to the account, which
+// include any overdraft facility and exclude pending holds, in the currency
+// of the account.
+func InsufficientFunds(available, amount Money, currency string) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("insufficient funds: available = %s %s, amount = %s %s", available, currency, amount, currency))
+}
+
+func CurrencyMismatch(cardNumber, accountCurrency, currency string) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("account of card %s is held in %s, not %s", maskDigits(cardNumber), accountCurrency, currency))
+}
+
+func ConversionRequired(from, to string) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("transfer from %s to %s requires conversion", from, to))
+}
+
+func NoExchangeRate(base, quote string) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("no exchange rate from %s to %s", base, quote))
+}
+
+func AmountTooSmallToConvert(amount Money, currency string) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("amount too small to convert: amount = %s %s", amount, currency))
+}
+
+func UnsupportedCurrency(currency string) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("currency %s is not supported", currency))
+}
+
+func IdempotencyKeyReused() APIError {
+	return NewAPIError(http.StatusUnprocessableEntity, fmt.Errorf("idempotency key already used with a different request"))
+}
+
+func InvalidTransactionID() APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("invalid transaction ID"))
+}
+
+func NoTransaction(id uuid.UUID) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("transaction %s doesn't exist", id))
+}
+
+func NotReversible() APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("reversal transactions cannot be reversed"))
+}
+
+func AlreadyReversed() APIError {
+	return NewAPIError(http.StatusConflict, fmt.Errorf("transaction already fully reversed"))
+}
+
+func RefundExceeds(remaining, amount Money) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("refund exceeds original transaction: remaining = %s, amount = %s", remaining, amount))
+}
+
+func InvalidHoldID() APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("invalid hold ID"))
+}
+
+func NoHold(id uuid.UUID) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("hold %s doesn't exist", id))
+}
+
+func HoldNotPending(status string) APIError {
+	return NewAPIError(http.StatusConflict, fmt.Errorf("hold is not pending: status = %s", status))
+}
+
+func CaptureExceeds(held, amount Money) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("capture exceeds hold: held = %s, amount = %s", held, amount))
+}
+
+func InvalidScheduledTransferID() APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("invalid scheduled transfer ID"))
+}
+
+func NoScheduledTransfer(id uuid.UUID) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("scheduled transfer %s doesn't exist", id))
+}
+
+func ScheduledTransferNotPending(status string) APIError {
+	return NewAPIError(http.StatusConflict, fmt.Errorf("scheduled transfer is not pending: status = %s", status))
+}
+
+func InvalidStandingOrderID() APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("invalid standing order ID"))
+}
+
+func NoStandingOrder(id uuid.UUID) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("standing order %s doesn't exist", id))
+}
+
+func StandingOrderNotActive(status string) APIError {
+	return NewAPIError(http.StatusConflict, fmt.Errorf("standing order is not active: status = %s", status))
+}
+
+func LimitExceeded(limit, allowed, requested string) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("%s limit exceeded: limit = %s, requested = %s", limit, allowed, requested))
+}
+
+func OverdraftInUse(balance Money) APIError {
+	return NewAPIError(http.StatusConflict, fmt.Errorf("overdraft limit doesn't cover current balance: balance = %s", balance))
+}
+
+func NoAccountType(accountType string) APIError {
+	return NewAPIError(http.StatusBadRequest, fmt.Errorf("account type %s doesn't exist", accountType))
 }
 
 func InvalidRequestData(errors map[string]string) APIError {
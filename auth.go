@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	accessToken  = "access"
+	refreshToken = "refresh"
+)
+
+type UserIDKey struct{}
+
+type RoleKey struct{}
+
+type TokenClaims struct {
+	UserID    int    `json:"uid"`
+	Role      string `json:"role"`
+	Type      string `json:"typ"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type TokenManager struct {
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewTokenManager(secret string, accessTTL, refreshTTL time.Duration) *TokenManager {
+	return &TokenManager{
+		secret:     []byte(secret),
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// IssuePair returns a new access token and refresh token for the user.
+func (m *TokenManager) IssuePair(userID int, role string) (string, string, error) {
+	now := time.Now()
+
+	access, err := m.sign(TokenClaims{UserID: userID, Role: role, Type: accessToken, ExpiresAt: now.Add(m.accessTTL).Unix()})
+	if err != nil {
+		return "", "", err
+	}
+
+	refresh, err := m.sign(TokenClaims{UserID: userID, Role: role, Type: refreshToken, ExpiresAt: now.Add(m.refreshTTL).Unix()})
+	if err != nil {
+		return "", "", err
+	}
+
+	return access, refresh, nil
+}
+
+// Parse verifies the token signature, expiry and type and returns its claims.
+func (m *TokenManager) Parse(token, tokenType string) (TokenClaims, error) {
+	var claims TokenClaims
+
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return claims, fmt.Errorf("malformed token")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return claims, fmt.Errorf("malformed token signature")
+	}
+
+	if !hmac.Equal(sig, m.mac(payload)) {
+		return claims, fmt.Errorf("invalid token signature")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return claims, fmt.Errorf("malformed token payload")
+	}
+
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return claims, fmt.Errorf("malformed token payload")
+	}
+
+	if claims.Type != tokenType {
+		return claims, fmt.Errorf("unexpected token type %q", claims.Type)
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, fmt.Errorf("token expired")
+	}
+
+	return claims, nil
+}
+
+func (m *TokenManager) sign(claims TokenClaims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(m.mac(payload)), nil
+}
+
+func (m *TokenManager) mac(payload string) []byte {
+	h := hmac.New(sha256.New, m.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			apiErr := Unauthorized()
+			writeJSON(w, apiErr.StatusCode, apiErr)
+			return
+		}
+
+		claims, err := s.tokens.Parse(token, accessToken)
+		if err != nil {
+			apiErr := Unauthorized()
+			writeJSON(w, apiErr.StatusCode, apiErr)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), UserIDKey{}, claims.UserID)
+		ctx = context.WithValue(ctx, RoleKey{}, claims.Role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireRole lets the request through only if the authenticated user has one of the roles.
+func requireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(roles, roleFromContext(r.Context())) {
+				apiErr := Forbidden()
+				writeJSON(w, apiErr.StatusCode, apiErr)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func userIDFromContext(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(UserIDKey{}).(int)
+	return id, ok
+}
+
+func roleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(RoleKey{}).(string)
+	return role
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "test-secret"
+
+func TestTokenManager(t *testing.T) {
+	tokens := NewTokenManager(testSecret, time.Minute, time.Hour)
+
+	access, refresh, err := tokens.IssuePair(42, roleCustomer)
+	require.NoError(t, err)
+	assert.NotEqual(t, access, refresh)
+
+	claims, err := tokens.Parse(access, accessToken)
+	require.NoError(t, err)
+	assert.Equal(t, 42, claims.UserID)
+
+	claims, err = tokens.Parse(refresh, refreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, 42, claims.UserID)
+}
+
+func TestTokenManager_Invalid(t *testing.T) {
+	tokens := NewTokenManager(testSecret, time.Minute, time.Hour)
+	expired := NewTokenManager(testSecret, -time.Minute, -time.Minute)
+	other := NewTokenManager("other-secret", time.Minute, time.Hour)
+
+	access, refresh, err := tokens.IssuePair(1, roleCustomer)
+	require.NoError(t, err)
+
+	expiredAccess, _, err := expired.IssuePair(1, roleCustomer)
+	require.NoError(t, err)
+
+	otherAccess, _, err := other.IssuePair(1, roleCustomer)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenType string
+	}{
+		{name: "Malformed", token: "garbage", tokenType: accessToken},
+		{name: "Tampered", token: access + "x", tokenType: accessToken},
+		{name: "Wrong secret", token: otherAccess, tokenType: accessToken},
+		{name: "Expired", token: expiredAccess, tokenType: accessToken},
+		{name: "Refresh as access", token: refresh, tokenType: accessToken},
+		{name: "Access as refresh", token: access, tokenType: refreshToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tokens.Parse(tt.token, tt.tokenType)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	tokens := NewTokenManager(testSecret, time.Minute, time.Hour)
+	srv := NewServer("", nil, tokens)
+
+	var gotID int
+	handler := srv.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID, _ = userIDFromContext(r.Context())
+	}))
+
+	access, _, err := tokens.IssuePair(7, roleCustomer)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/user/7", nil)
+	req.Header.Set("Authorization", "Bearer "+access)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 7, gotID)
+
+	req = httptest.NewRequest(http.MethodGet, "/user/7", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAuthorizeUser(t *testing.T) {
+	ctx := context.WithValue(context.Background(), UserIDKey{}, 7)
+
+	require.NoError(t, authorizeUser(ctx, 7))
+
+	err := authorizeUser(ctx, 8)
+	require.Error(t, err)
+	assert.Equal(t, Forbidden(), err)
+
+	err = authorizeUser(context.Background(), 7)
+	require.Error(t, err)
+	assert.Equal(t, Unauthorized(), err)
+}
+
+func TestRequireRole(t *testing.T) {
+	handler := requireRole(roleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name         string
+		role         string
+		expectedCode int
+	}{
+		{name: "Admin", role: roleAdmin, expectedCode: http.StatusOK},
+		{name: "Support", role: roleSupport, expectedCode: http.StatusForbidden},
+		{name: "Customer", role: roleCustomer, expectedCode: http.StatusForbidden},
+		{name: "No role", role: "", expectedCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), RoleKey{}, tt.role)
+			req := httptest.NewRequest(http.MethodGet, "/admin/users", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "time"
+
+// Clock tells the current time. Background jobs read the time through it so
+// tests can move time forward instead of waiting.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
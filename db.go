@@ -2,52 +2,156 @@ package main
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const (
-	transferTransaction        = "transfer"
-	depositTransaction         = "deposit"
-	insertUser                 = "insert_user"
-	errDuplicateConstraintCode = "23505"
+	transferTransaction         = "transfer"
+	depositTransaction          = "deposit"
+	withdrawalTransaction       = "withdrawal"
+	reversalTransaction         = "reversal"
+	captureTransaction          = "capture"
+	interestTransaction         = "interest"
+	holdPending                 = "pending"
+	holdCaptured                = "captured"
+	holdReleased                = "released"
+	holdExpired                 = "expired"
+	defaultHoldTTL              = time.Hour * 24 * 7
+	scheduledPending            = "pending"
+	scheduledProcessing         = "processing"
+	scheduledExecuted           = "executed"
+	scheduledFailed             = "failed"
+	scheduledCancelled          = "cancelled"
+	scheduledClaimTimeout       = time.Minute * 5
+	insertUser                  = "insert_user"
+	cashAccount                 = "cash"
+	interestAccount             = "interest"
+	fxAccount                   = "fx"
+	defaultCurrency             = "USD"
+	checkingAccount             = "checking"
+	savingsAccount              = "savings"
+	errDuplicateConstraintCode  = "23505"
+	errCheckConstraintCode      = "23514"
+	errForeignKeyConstraintCode = "23503"
+	cardNumberConstraint        = "cards_card_number_index_key"
+	accountCurrencyConstraint   = "accounts_currency_fkey"
+	rateBaseConstraint          = "exchange_rates_base_fkey"
+	cardNumberAttempts          = 5
+	maxCardVerificationFailures = 5
+	cardVerificationLockout     = time.Hour * 24
 )
 
 type Storage struct {
-	conn *pgx.Conn
+	pool   *pgxpool.Pool
+	cvvKey []byte
+	keys   *Keyring
 }
 
-func NewStorage(ctx context.Context, connString string) (*Storage, error) {
-	conn, err := pgx.Connect(ctx, connString)
+// querier is satisfied by both the pool and a transaction.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// PoolConfig tunes the connection pool. Zero values keep the pgxpool defaults.
+type PoolConfig struct {
+	MinConns          int32
+	MaxConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+}
+
+// PoolStats is a snapshot of the connection pool state.
+type PoolStats struct {
+	TotalConns        int32         `json:"totalConns"`
+	AcquiredConns     int32         `json:"acquiredConns"`
+	IdleConns         int32         `json:"idleConns"`
+	MaxConns          int32         `json:"maxConns"`
+	AcquireCount      int64         `json:"acquireCount"`
+	EmptyAcquireCount int64         `json:"emptyAcquireCount"`
+	AcquireDuration   time.Duration `json:"acquireDuration"`
+}
+
+// NewStorage connects to the database. The CVV secret keys the hashes card
+// verification values are stored as and the keyring seals PII.
+func NewStorage(ctx context.Context, connString string, poolCfg PoolConfig, cvvSecret string, keys *Keyring) (*Storage, error) {
+	cfg, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection string: %s", err)
+	}
+
+	if poolCfg.MinConns > 0 {
+		cfg.MinConns = poolCfg.MinConns
+	}
+	if poolCfg.MaxConns > 0 {
+		cfg.MaxConns = poolCfg.MaxConns
+	}
+	if poolCfg.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = poolCfg.MaxConnLifetime
+	}
+	if poolCfg.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = poolCfg.MaxConnIdleTime
+	}
+	if poolCfg.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = poolCfg.HealthCheckPeriod
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to establish connection: %s", err)
 	}
 
-	if err := conn.Ping(ctx); err != nil {
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, err
 	}
 
-	return &Storage{conn: conn}, nil
+	return &Storage{pool: pool, cvvKey: []byte(cvvSecret), keys: keys}, nil
+}
+
+func (s *Storage) Close() {
+	s.pool.Close()
 }
 
-func (s *Storage) Close(ctx context.Context) error {
-	return s.conn.Close(ctx)
+func (s *Storage) Stats() PoolStats {
+	stat := s.pool.Stat()
+
+	return PoolStats{
+		TotalConns:        stat.TotalConns(),
+		AcquiredConns:     stat.AcquiredConns(),
+		IdleConns:         stat.IdleConns(),
+		MaxConns:          stat.MaxConns(),
+		AcquireCount:      stat.AcquireCount(),
+		EmptyAcquireCount: stat.EmptyAcquireCount(),
+		AcquireDuration:   stat.AcquireDuration(),
+	}
 }
 
 func (s *Storage) Register(ctx context.Context, user *User) (id int, err error) {
-	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
 	if err != nil {
 		return 0, err
 	}
 
 	defer func() { err = rollback(ctx, tx, err) }()
 
-	if err = tx.QueryRow(ctx, insertUserQuery, user.FirstName, user.LastName, user.PhoneNumber, user.PasswordHash, user.Account.Balance, user.Account.Card.Number, user.Account.Card.CVV, user.Account.Card.ExpireTime).Scan(&id); err != nil {
+	keyID, dek, sealed, err := s.keys.Seal(user.FirstName, user.LastName, user.PhoneNumber)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.QueryRow(ctx, insertUserQuery, keyID, dek, sealed[0], sealed[1], sealed[2], s.keys.Index(phoneIndex, user.PhoneNumber), user.PasswordHash).Scan(&id); err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == errDuplicateConstraintCode {
 			return 0, UserExists()
@@ -55,205 +159,2381 @@ func (s *Storage) Register(ctx context.Context, user *User) (id int, err error)
 		return 0, err
 	}
 
+	for i := range user.Accounts {
+		if err = s.insertAccount(ctx, tx, id, &user.Accounts[i]); err != nil {
+			return 0, err
+		}
+	}
+
+	user.ID = id
+
 	return id, nil
 }
 
-func (s *Storage) Deposit(ctx context.Context, deposit *TransactionRequest) (transaction Transaction, err error) {
-	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+// OpenAccount opens another account with its own card for the user.
+func (s *Storage) OpenAccount(ctx context.Context, userID int, account *Account) (err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
 	if err != nil {
-		return transaction, err
+		return err
 	}
 
 	defer func() { err = rollback(ctx, tx, err) }()
 
-	var toUserID int
-	if err = tx.QueryRow(ctx, cardNumberQuery, deposit.ToCardNumber).Scan(&toUserID); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return transaction, NoAccount(deposit.ToCardNumber)
+	if err = s.insertAccount(ctx, tx, userID, account); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == errForeignKeyConstraintCode {
+			if pgErr.ConstraintName == accountCurrencyConstraint {
+				return UnsupportedCurrency(account.Currency)
+			}
+			return NoUser()
 		}
-		return transaction, err
+		return err
 	}
 
-	stmt, err := tx.Prepare(ctx, depositTransaction, depositQuery)
+	return nil
+}
+
+func (s *Storage) AccountByID(ctx context.Context, id int) (Account, error) {
+	rows, err := s.pool.Query(ctx, accountByIDQuery, id)
 	if err != nil {
-		return transaction, err
+		return Account{}, err
 	}
 
-	_, err = tx.Exec(ctx, stmt.Name, deposit.Amount, deposit.ToCardNumber)
+	accounts, err := s.scanAccounts(rows)
 	if err != nil {
-		return transaction, err
+		return Account{}, err
 	}
 
-	transaction, err = insertDepositTransaction(ctx, tx, deposit)
-	if err != nil {
-		return transaction, err
+	if len(accounts) == 0 {
+		return Account{}, NoAccountID(id)
 	}
 
-	return transaction, nil
+	return accounts[0], nil
 }
 
-func (s *Storage) Transfer(ctx context.Context, transfer *TransactionRequest) (transaction Transaction, err error) {
-	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+// IssueCard adds another physical or virtual card to the account.
+func (s *Storage) IssueCard(ctx context.Context, accountID int, card *Card) (err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
 	if err != nil {
-		return transaction, err
+		return err
 	}
 
 	defer func() { err = rollback(ctx, tx, err) }()
 
-	var toUserID int
-	if err = tx.QueryRow(ctx, cardNumberQuery, transfer.ToCardNumber).Scan(&toUserID); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return transaction, NoAccount(transfer.ToCardNumber)
+	if err = s.insertCard(ctx, tx, accountID, card); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == errForeignKeyConstraintCode {
+			return NoAccountID(accountID)
 		}
-		return transaction, err
+		return err
 	}
 
-	var fromUserBalance float64
-	if err = tx.QueryRow(ctx, balanceQuery, transfer.FromCardNumber).Scan(&fromUserBalance); err != nil {
+	return nil
+}
+
+func (s *Storage) CardByID(ctx context.Context, id int) (Card, error) {
+	card, err := s.scanCard(s.pool.QueryRow(ctx, cardByIDQuery, id))
+	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return transaction, NoAccount(transfer.FromCardNumber)
+			return card, NoCard(id)
 		}
-		return transaction, err
+		return card, err
 	}
 
-	if fromUserBalance < transfer.Amount {
-		return transaction, InsufficientFunds(fromUserBalance, transfer.Amount)
+	return card, nil
+}
+
+// UpdateCardStatus moves the card to status if it is currently in one of
+// the from statuses.
+func (s *Storage) UpdateCardStatus(ctx context.Context, id int, from []string, status string) (Card, error) {
+	card, err := s.scanCard(s.pool.QueryRow(ctx, updateCardStatusQuery, id, from, status))
+	if err == nil {
+		return card, nil
+	}
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return card, err
 	}
 
-	stmt, err := tx.Prepare(ctx, transferTransaction, transferQuery)
+	card, err = s.CardByID(ctx, id)
 	if err != nil {
-		return transaction, err
+		return card, err
 	}
 
-	_, err = tx.Exec(ctx, stmt.Name, transfer.FromCardNumber, transfer.Amount, transfer.ToCardNumber)
+	return Card{}, CardStatusConflict(card.Status, status)
+}
+
+// ReplaceCard blocks an active or frozen card and issues the replacement
+// of the same kind on the same account.
+func (s *Storage) ReplaceCard(ctx context.Context, id int, replacement *Card) (err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
 	if err != nil {
-		return transaction, err
+		return err
 	}
 
-	transaction, err = insertTransferTransaction(ctx, tx, transfer)
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	card, err := s.scanCard(tx.QueryRow(ctx, lockCardQuery, id))
 	if err != nil {
-		return transaction, err
+		if errors.Is(err, pgx.ErrNoRows) {
+			return NoCard(id)
+		}
+		return err
 	}
 
-	return transaction, nil
-}
+	if card.Status == cardBlocked {
+		return CardStatusConflict(card.Status, cardBlocked)
+	}
 
-func (s *Storage) UserByID(ctx context.Context, id int) (user User, err error) {
-	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadOnly})
+	replacement.Kind = card.Kind
+	replacement.AccountID = card.AccountID
 
-	defer func() { err = rollback(ctx, tx, err) }()
+	if err = s.insertCard(ctx, tx, card.AccountID, replacement); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, replaceCardQuery, id, replacement.ID)
+	return err
+}
 
-	if err = s.conn.QueryRow(ctx, getUserByIDQuery, id).Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.CreatedAt, &user.Account.ID, &user.Account.Balance, &user.Account.Card.ID, &user.Account.Card.Number, &user.Account.Card.CVV, &user.Account.Card.ExpireTime); err != nil {
+// ActivateCard gives a card issued without a CVV the one in card.CVV.
+func (s *Storage) ActivateCard(ctx context.Context, card *Card) error {
+	var id int
+	if err := s.pool.QueryRow(ctx, activateCardQuery, card.ID, s.hashCVV(card.Number, card.CVV)).Scan(&id); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return user, NoUser()
+			return CardAlreadyActivated(card.ID)
 		}
-		return user, err
+		return err
 	}
 
-	return user, nil
+	return nil
 }
 
-func (s *Storage) TransactionsByUser(ctx context.Context, id int) (transactions []Transaction, err error) {
-	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadOnly})
+// ExpiringCards returns up to limit active cards expiring before the given
+// day that haven't been reissued yet.
+func (s *Storage) ExpiringCards(ctx context.Context, before time.Time, limit int) ([]Card, error) {
+	rows, err := s.pool.Query(ctx, expiringCardsQuery, before, limit)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	var cards []Card
+
+	for rows.Next() {
+		card, err := s.scanCard(rows)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+
+	return cards, rows.Err()
+}
+
+// ReissueCard issues the replacement of a card approaching expiry and
+// notifies the owner. The old card stays usable until it expires. Nobody is
+// there to be shown the replacement's CVV, so it is issued without one and
+// the owner activates it to get one.
+func (s *Storage) ReissueCard(ctx context.Context, id int, replacement *Card) (err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return err
+	}
 
 	defer func() { err = rollback(ctx, tx, err) }()
 
-	rows, err := tx.Query(ctx, getTransactionsByUserQuery, id)
+	card, err := s.scanCard(tx.QueryRow(ctx, lockCardQuery, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return NoCard(id)
+		}
+		return err
+	}
+
+	var replacedBy *int
+	if err = tx.QueryRow(ctx, replacedByQuery, id).Scan(&replacedBy); err != nil {
+		return err
+	}
+
+	if card.Status != cardActive || replacedBy != nil {
+		return CardStatusConflict(card.Status, cardActive)
+	}
+
+	replacement.Kind = card.Kind
+	replacement.AccountID = card.AccountID
+	replacement.CVV = ""
+
+	if err = s.insertCard(ctx, tx, card.AccountID, replacement); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, reissueCardQuery, id, replacement.ID); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("card %s expires %s, replacement card %s has been issued, activate it to get its CVV", maskDigits(card.Number), card.ExpireTime.Format(layout), maskDigits(replacement.Number))
+
+	_, err = tx.Exec(ctx, insertNotificationQuery, card.AccountID, msg)
+	return err
+}
+
+func (s *Storage) NotificationsByUser(ctx context.Context, userID int) ([]Notification, error) {
+	rows, err := s.pool.Query(ctx, notificationsByUserQuery, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	var notifications []Notification
+
 	for rows.Next() {
-		transaction := Transaction{}
-		if err := rows.Scan(&transaction.ID, &transaction.Type, &transaction.Amount, &transaction.ToCardNumber, &transaction.FromCardNumber, &transaction.CreatedAt); err != nil {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.Message, &n.CreatedAt); err != nil {
 			return nil, err
 		}
+		notifications = append(notifications, n)
+	}
 
-		transactions = append(transactions, transaction)
+	return notifications, rows.Err()
+}
+
+// VerifyCard checks card-present details against an active, unexpired card.
+// Every failure is reported the same way so nothing about the card leaks, and
+// maxCardVerificationFailures in a row lock the card's verification for
+// cardVerificationLockout.
+func (s *Storage) VerifyCard(ctx context.Context, req *CardVerificationRequest) error {
+	index := s.keys.Index(cardIndex, req.CardNumber)
+
+	var (
+		hash       string
+		expireTime time.Time
+		status     string
+	)
+	if err := s.pool.QueryRow(ctx, cardVerificationQuery, index, maxCardVerificationFailures, time.Now().Add(cardVerificationLockout)).Scan(&hash, &expireTime, &status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return CardVerificationFailed()
+		}
+		return err
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	if status != cardActive || (Card{ExpireTime: expireTime}).Expired(time.Now()) {
+		return CardVerificationFailed()
 	}
 
-	if len(transactions) == 0 {
-		return nil, NoUser()
+	if expireTime.Format(layout) != req.ExpireTime || !hmac.Equal([]byte(hash), []byte(s.hashCVV(req.CardNumber, req.CVV))) {
+		return CardVerificationFailed()
 	}
 
-	return transactions, nil
+	_, err := s.pool.Exec(ctx, resetCardVerificationQuery, index)
+	return err
+}
+
+// TokenizeCard returns the card's token, creating it on first use. A new
+// token colliding with another card's is generated again.
+func (s *Storage) TokenizeCard(ctx context.Context, card Card) (token CardToken, err error) {
+	for attempt := 1; attempt <= cardNumberAttempts; attempt++ {
+		if _, err = s.pool.Exec(ctx, insertCardTokenQuery, newCardToken(card.Number), card.ID); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == errForeignKeyConstraintCode {
+				return token, NoCard(card.ID)
+			}
+			return token, err
+		}
+
+		err = s.pool.QueryRow(ctx, cardTokenByCardQuery, card.ID).Scan(&token.Token, &token.CardID, &token.CreatedAt)
+		if err == nil {
+			return token, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return token, err
+		}
+	}
+
+	return token, fmt.Errorf("failed to generate a unique token for card %d", card.ID)
 }
 
-func (s *Storage) Users(ctx context.Context) ([]User, error) {
-	var users []User
+func (s *Storage) CardByToken(ctx context.Context, token string) (Card, error) {
+	card, err := s.scanCard(s.pool.QueryRow(ctx, cardByTokenQuery, token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return card, NoCardToken()
+		}
+		return card, err
+	}
+
+	return card, nil
+}
+
+// Detokenize records the request in the detokenization log before looking
+// the token up, so failed attempts are recorded too.
+func (s *Storage) Detokenize(ctx context.Context, req *DetokenizeRequest) (Card, error) {
+	if _, err := s.pool.Exec(ctx, insertDetokenizationQuery, req.Token, req.UserID, req.Reason); err != nil {
+		return Card{}, err
+	}
 
-	rows, err := s.conn.Query(ctx, getUsersQuery)
+	return s.CardByToken(ctx, req.Token)
+}
+
+func (s *Storage) Detokenizations(ctx context.Context) ([]Detokenization, error) {
+	rows, err := s.pool.Query(ctx, detokenizationsQuery)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	var detokenizations []Detokenization
+
 	for rows.Next() {
-		user := User{}
-		if err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.PhoneNumber, &user.CreatedAt, &user.Account.ID, &user.Account.Balance, &user.Account.Card.ID, &user.Account.Card.Number, &user.Account.Card.CVV, &user.Account.Card.ExpireTime); err != nil {
+		var d Detokenization
+		if err := rows.Scan(&d.ID, &d.Token, &d.UserID, &d.Reason, &d.CreatedAt); err != nil {
 			return nil, err
 		}
-
-		users = append(users, user)
+		detokenizations = append(detokenizations, d)
 	}
 
-	if err = rows.Err(); err != nil {
+	return detokenizations, rows.Err()
+}
+
+func (s *Storage) CardsByAccount(ctx context.Context, accountID int) ([]Card, error) {
+	rows, err := s.pool.Query(ctx, cardsByAccountQuery, accountID)
+	if err != nil {
 		return nil, err
 	}
 
-	return users, nil
+	return s.scanCards(rows)
 }
 
-func insertDepositTransaction(ctx context.Context, tx pgx.Tx, tr *TransactionRequest) (Transaction, error) {
+func (s *Storage) Deposit(ctx context.Context, deposit *TransactionRequest) (transaction Transaction, err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return transaction, err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	replay, err := s.claimIdempotencyKey(ctx, tx, deposit)
+	if err != nil {
+		return transaction, err
+	}
+	if replay != nil {
+		return *replay, nil
+	}
+
 	var (
-		transactionID uuid.UUID
-		createdAt     time.Time
+		toAccountID int
+		currency    string
 	)
+	if err = tx.QueryRow(ctx, accountIDQuery, s.keys.Index(cardIndex, deposit.ToCardNumber)).Scan(&toAccountID, &currency); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return transaction, s.unavailableCard(ctx, tx, deposit.ToCardNumber)
+		}
+		return transaction, err
+	}
 
-	if err := tx.QueryRow(ctx, insertDepositTransactionQuery, tr.ToCardNumber, tr.Type, tr.Amount, tr.ToCardNumber).Scan(&transactionID, &createdAt); err != nil {
-		return Transaction{}, err
+	if err = checkCurrency(deposit.ToCardNumber, currency, deposit.Currency); err != nil {
+		return transaction, err
 	}
 
-	transaction := Transaction{
-		ID:           transactionID,
-		Type:         tr.Type,
-		Amount:       tr.Amount,
-		ToCardNumber: tr.ToCardNumber,
-		CreatedAt:    createdAt,
+	var cashAccountID int
+	if err = tx.QueryRow(ctx, systemAccountQuery, cashAccount, currency).Scan(&cashAccountID); err != nil {
+		return transaction, err
+	}
+
+	transaction, err = s.insertDepositTransaction(ctx, tx, deposit, currency)
+	if err != nil {
+		return transaction, err
+	}
+
+	if err = postEntries(ctx, tx, transaction.ID,
+		Posting{AccountID: cashAccountID, Amount: -deposit.Amount},
+		Posting{AccountID: toAccountID, Amount: deposit.Amount},
+	); err != nil {
+		return transaction, err
+	}
+
+	if err = saveIdempotencyKey(ctx, tx, deposit, transaction); err != nil {
+		return transaction, err
 	}
 
 	return transaction, nil
 }
 
-func insertTransferTransaction(ctx context.Context, tx pgx.Tx, tr *TransactionRequest) (Transaction, error) {
+func (s *Storage) Transfer(ctx context.Context, transfer *TransactionRequest) (transaction Transaction, err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return transaction, err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	replay, err := s.claimIdempotencyKey(ctx, tx, transfer)
+	if err != nil {
+		return transaction, err
+	}
+	if replay != nil {
+		return *replay, nil
+	}
+
 	var (
-		transactionID uuid.UUID
-		createdAt     time.Time
+		toAccountID int
+		toCurrency  string
 	)
+	if err = tx.QueryRow(ctx, accountIDQuery, s.keys.Index(cardIndex, transfer.ToCardNumber)).Scan(&toAccountID, &toCurrency); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return transaction, s.unavailableCard(ctx, tx, transfer.ToCardNumber)
+		}
+		return transaction, err
+	}
 
-	if err := tx.QueryRow(ctx, insertTransferTransactionQuery, tr.ToCardNumber, tr.FromCardNumber, tr.Type, tr.Amount).Scan(&transactionID, &createdAt); err != nil {
-		return Transaction{}, err
+	// Lock both accounts in id order so concurrent transfers between the same
+	// accounts queue up instead of deadlocking or reading a stale balance.
+	if _, err = tx.Exec(ctx, lockAccountsQuery, s.keys.Index(cardIndex, transfer.FromCardNumber), s.keys.Index(cardIndex, transfer.ToCardNumber)); err != nil {
+		return transaction, err
 	}
 
-	transaction := Transaction{
-		ID:             transactionID,
-		Type:           tr.Type,
-		Amount:         tr.Amount,
-		FromCardNumber: tr.FromCardNumber,
-		ToCardNumber:   tr.ToCardNumber,
-		CreatedAt:      createdAt,
+	var (
+		fromAccountID   int
+		fromUserBalance Money
+		currency        string
+	)
+	if err = tx.QueryRow(ctx, balanceQuery, s.keys.Index(cardIndex, transfer.FromCardNumber)).Scan(&fromAccountID, &fromUserBalance, &currency); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return transaction, s.unavailableCard(ctx, tx, transfer.FromCardNumber)
+		}
+		return transaction, err
 	}
 
-	return transaction, nil
+	if err = checkCurrency(transfer.FromCardNumber, currency, transfer.Currency); err != nil {
+		return transaction, err
+	}
+
+	if toCurrency != currency && !transfer.Convert {
+		return transaction, ConversionRequired(currency, toCurrency)
+	}
+
+	if fromUserBalance < transfer.Amount {
+		return transaction, InsufficientFunds(fromUserBalance, transfer.Amount, currency)
+	}
+
+	if err = checkLimits(ctx, tx, fromAccountID, transfer.Amount); err != nil {
+		return transaction, err
+	}
+
+	postings := []Posting{
+		{AccountID: fromAccountID, Amount: -transfer.Amount},
+		{AccountID: toAccountID, Amount: transfer.Amount},
+	}
+
+	var conversion *Conversion
+	if toCurrency != currency {
+		conversion, postings, err = convert(ctx, tx, fromAccountID, toAccountID, transfer.Amount, currency, toCurrency)
+		if err != nil {
+			return transaction, err
+		}
+	}
+
+	transaction, err = s.insertTransferTransaction(ctx, tx, transfer, currency, conversion)
+	if err != nil {
+		return transaction, err
+	}
+
+	if err = postEntries(ctx, tx, transaction.ID, postings...); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == errCheckConstraintCode {
+			return Transaction{}, InsufficientFunds(fromUserBalance, transfer.Amount, currency)
+		}
+		return Transaction{}, err
+	}
+
+	if err = saveIdempotencyKey(ctx, tx, transfer, transaction); err != nil {
+		return transaction, err
+	}
+
+	return transaction, nil
+}
+
+func (s *Storage) Withdraw(ctx context.Context, withdrawal *TransactionRequest) (transaction Transaction, err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return transaction, err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	replay, err := s.claimIdempotencyKey(ctx, tx, withdrawal)
+	if err != nil {
+		return transaction, err
+	}
+	if replay != nil {
+		return *replay, nil
+	}
+
+	if _, err = tx.Exec(ctx, lockAccountsQuery, s.keys.Index(cardIndex, withdrawal.FromCardNumber), s.keys.Index(cardIndex, withdrawal.FromCardNumber)); err != nil {
+		return transaction, err
+	}
+
+	var (
+		fromAccountID   int
+		fromUserBalance Money
+		currency        string
+	)
+	if err = tx.QueryRow(ctx, balanceQuery, s.keys.Index(cardIndex, withdrawal.FromCardNumber)).Scan(&fromAccountID, &fromUserBalance, &currency); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return transaction, s.unavailableCard(ctx, tx, withdrawal.FromCardNumber)
+		}
+		return transaction, err
+	}
+
+	if err = checkCurrency(withdrawal.FromCardNumber, currency, withdrawal.Currency); err != nil {
+		return transaction, err
+	}
+
+	if fromUserBalance < withdrawal.Amount {
+		return transaction, InsufficientFunds(fromUserBalance, withdrawal.Amount, currency)
+	}
+
+	if err = checkLimits(ctx, tx, fromAccountID, withdrawal.Amount); err != nil {
+		return transaction, err
+	}
+
+	var cashAccountID int
+	if err = tx.QueryRow(ctx, systemAccountQuery, cashAccount, currency).Scan(&cashAccountID); err != nil {
+		return transaction, err
+	}
+
+	transaction, err = s.insertWithdrawalTransaction(ctx, tx, withdrawal, currency)
+	if err != nil {
+		return transaction, err
+	}
+
+	if err = postEntries(ctx, tx, transaction.ID,
+		Posting{AccountID: fromAccountID, Amount: -withdrawal.Amount},
+		Posting{AccountID: cashAccountID, Amount: withdrawal.Amount},
+	); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == errCheckConstraintCode {
+			return Transaction{}, InsufficientFunds(fromUserBalance, withdrawal.Amount, currency)
+		}
+		return Transaction{}, err
+	}
+
+	if err = saveIdempotencyKey(ctx, tx, withdrawal, transaction); err != nil {
+		return transaction, err
+	}
+
+	return transaction, nil
+}
+
+// Reverse creates a compensating transaction for the original one. The amount
+// may be partial; the sum of all reversals never exceeds the original amount.
+func (s *Storage) Reverse(ctx context.Context, reversal *ReversalRequest) (transaction Transaction, err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return transaction, err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	original, err := s.scanTransaction(tx.QueryRow(ctx, lockTransactionQuery, reversal.TransactionID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return transaction, NoTransaction(reversal.TransactionID)
+		}
+		return transaction, err
+	}
+
+	if original.ReversalOf != nil {
+		return transaction, NotReversible()
+	}
+
+	var reversed Money
+	if err = tx.QueryRow(ctx, reversedAmountQuery, reversal.TransactionID).Scan(&reversed); err != nil {
+		return transaction, err
+	}
+
+	remaining := original.Amount - reversed
+	if remaining == 0 {
+		return transaction, AlreadyReversed()
+	}
+
+	amount := reversal.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+
+	if amount > remaining {
+		return transaction, RefundExceeds(remaining, amount)
+	}
+
+	originalPostings, err := postingsByTransaction(ctx, tx, reversal.TransactionID)
+	if err != nil {
+		return transaction, err
+	}
+
+	// Every leg of the original moved exactly its amount, so the
+	// compensating legs are the negated legs scaled to the refund. Converted
+	// legs of a small refund can round down to nothing; they cancel out
+	// within their currency and are left out.
+	postings := make([]Posting, 0, len(originalPostings))
+	accountIDs := make([]int, 0, len(originalPostings))
+	for _, p := range originalPostings {
+		refund := -p.Amount * amount / original.Amount
+		if refund == 0 {
+			continue
+		}
+
+		postings = append(postings, Posting{AccountID: p.AccountID, Amount: refund})
+		accountIDs = append(accountIDs, p.AccountID)
+	}
+
+	accounts, err := lockAccountsByID(ctx, tx, accountIDs)
+	if err != nil {
+		return transaction, err
+	}
+
+	var (
+		debited       Account
+		debitedAmount Money
+	)
+	for _, p := range postings {
+		account, ok := accounts[p.AccountID]
+		if !ok || p.Amount > 0 {
+			continue
+		}
+
+		if account.AvailableBalance < -p.Amount {
+			return transaction, InsufficientFunds(account.AvailableBalance, -p.Amount, account.Currency)
+		}
+
+		debited, debitedAmount = account, -p.Amount
+	}
+
+	// A converted transfer is refunded at its original rate, in the same
+	// proportion as its legs.
+	var conversion *Conversion
+	if original.Conversion != nil {
+		conversion = &Conversion{
+			Amount:   original.Conversion.Amount * amount / original.Amount,
+			Currency: original.Conversion.Currency,
+			Rate:     original.Conversion.Rate,
+		}
+	}
+
+	convertedAmount, convertedCurrency, exchangeRate := conversionColumns(conversion)
+
+	var createdAt time.Time
+	if err = tx.QueryRow(ctx, insertReversalTransactionQuery, reversalTransaction, amount, s.cardNumberIndex(original.FromCardNumber), s.cardNumberIndex(original.ToCardNumber), reversal.TransactionID, original.Currency, convertedAmount, convertedCurrency, exchangeRate).Scan(&transaction.ID, &createdAt); err != nil {
+		return Transaction{}, err
+	}
+
+	transaction.Type = reversalTransaction
+	transaction.Amount = amount
+	transaction.Currency = original.Currency
+	transaction.Conversion = conversion
+	transaction.FromCardNumber = original.ToCardNumber
+	transaction.ToCardNumber = original.FromCardNumber
+	transaction.ReversalOf = &reversal.TransactionID
+	transaction.CreatedAt = createdAt
+
+	if err = postEntries(ctx, tx, transaction.ID, postings...); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == errCheckConstraintCode {
+			return Transaction{}, InsufficientFunds(debited.AvailableBalance, debitedAmount, debited.Currency)
+		}
+		return Transaction{}, err
+	}
+
+	return transaction, nil
+}
+
+// PlaceHold reserves part of the card's available balance for a merchant
+// without moving money. The card is verified first, like VerifyCard does,
+// so a merchant can't hold funds on a card number alone. The hold is later
+// captured or released.
+func (s *Storage) PlaceHold(ctx context.Context, req *HoldRequest) (hold Hold, err error) {
+	if err = s.VerifyCard(ctx, &CardVerificationRequest{CardNumber: req.CardNumber, ExpireTime: req.CardExpireTime, CVV: req.CVV}); err != nil {
+		return hold, err
+	}
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return hold, err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	var (
+		merchantAccountID int
+		merchantCurrency  string
+	)
+	if err = tx.QueryRow(ctx, accountIDQuery, s.keys.Index(cardIndex, req.MerchantCardNumber)).Scan(&merchantAccountID, &merchantCurrency); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return hold, s.unavailableCard(ctx, tx, req.MerchantCardNumber)
+		}
+		return hold, err
+	}
+
+	if _, err = tx.Exec(ctx, lockAccountsQuery, s.keys.Index(cardIndex, req.CardNumber), s.keys.Index(cardIndex, req.CardNumber)); err != nil {
+		return hold, err
+	}
+
+	var (
+		accountID int
+		available Money
+		currency  string
+	)
+	if err = tx.QueryRow(ctx, balanceQuery, s.keys.Index(cardIndex, req.CardNumber)).Scan(&accountID, &available, &currency); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return hold, s.unavailableCard(ctx, tx, req.CardNumber)
+		}
+		return hold, err
+	}
+
+	// Captures aren't converted, so the merchant must take the card's currency.
+	if err = checkCurrency(req.MerchantCardNumber, merchantCurrency, currency); err != nil {
+		return hold, err
+	}
+
+	if available < req.Amount {
+		return hold, InsufficientFunds(available, req.Amount, currency)
+	}
+
+	expiresAt := time.Now().Add(defaultHoldTTL)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+
+	if err = tx.QueryRow(ctx, insertHoldQuery, accountID, s.keys.Index(cardIndex, req.CardNumber), s.keys.Index(cardIndex, req.MerchantCardNumber), req.Amount, currency, expiresAt).Scan(&hold.ID, &hold.CreatedAt); err != nil {
+		return Hold{}, err
+	}
+
+	hold.CardNumber = req.CardNumber
+	hold.MerchantCardNumber = req.MerchantCardNumber
+	hold.Amount = req.Amount
+	hold.Currency = currency
+	hold.Status = holdPending
+	hold.ExpiresAt = expiresAt
+
+	return hold, nil
+}
+
+func (s *Storage) HoldByID(ctx context.Context, id uuid.UUID) (Hold, error) {
+	hold, err := s.scanHold(s.pool.QueryRow(ctx, holdQuery, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return hold, NoHold(id)
+		}
+		return hold, err
+	}
+
+	return hold, nil
+}
+
+// CaptureHold moves the captured amount from the held card to the merchant
+// and closes the hold. Any uncaptured remainder is released.
+func (s *Storage) CaptureHold(ctx context.Context, capture *CaptureRequest) (transaction Transaction, err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return transaction, err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	hold, err := s.scanHold(tx.QueryRow(ctx, lockHoldQuery, capture.HoldID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return transaction, NoHold(capture.HoldID)
+		}
+		return transaction, err
+	}
+
+	if err = checkHoldPending(hold); err != nil {
+		return transaction, err
+	}
+
+	amount := capture.Amount
+	if amount == 0 {
+		amount = hold.Amount
+	}
+
+	if amount > hold.Amount {
+		return transaction, CaptureExceeds(hold.Amount, amount)
+	}
+
+	if _, err = tx.Exec(ctx, lockAccountsQuery, s.keys.Index(cardIndex, hold.CardNumber), s.keys.Index(cardIndex, hold.MerchantCardNumber)); err != nil {
+		return transaction, err
+	}
+
+	var (
+		fromAccountID int
+		available     Money
+		toAccountID   int
+	)
+	if err = tx.QueryRow(ctx, balanceQuery, s.keys.Index(cardIndex, hold.CardNumber)).Scan(&fromAccountID, &available, nil); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return transaction, s.unavailableCard(ctx, tx, hold.CardNumber)
+		}
+		return transaction, err
+	}
+
+	if err = tx.QueryRow(ctx, accountIDQuery, s.keys.Index(cardIndex, hold.MerchantCardNumber)).Scan(&toAccountID, nil); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return transaction, s.unavailableCard(ctx, tx, hold.MerchantCardNumber)
+		}
+		return transaction, err
+	}
+
+	// The available balance already excludes this hold.
+	if available+hold.Amount < amount {
+		return transaction, InsufficientFunds(available+hold.Amount, amount, hold.Currency)
+	}
+
+	if err = checkLimits(ctx, tx, fromAccountID, amount); err != nil {
+		return transaction, err
+	}
+
+	var createdAt time.Time
+	if err = tx.QueryRow(ctx, insertCaptureTransactionQuery, captureTransaction, amount, s.keys.Index(cardIndex, hold.MerchantCardNumber), s.keys.Index(cardIndex, hold.CardNumber), hold.Currency).Scan(&transaction.ID, &createdAt); err != nil {
+		return Transaction{}, err
+	}
+
+	transaction.Type = captureTransaction
+	transaction.Amount = amount
+	transaction.Currency = hold.Currency
+	transaction.FromCardNumber = hold.CardNumber
+	transaction.ToCardNumber = hold.MerchantCardNumber
+	transaction.CreatedAt = createdAt
+
+	if err = postEntries(ctx, tx, transaction.ID,
+		Posting{AccountID: fromAccountID, Amount: -amount},
+		Posting{AccountID: toAccountID, Amount: amount},
+	); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == errCheckConstraintCode {
+			return Transaction{}, InsufficientFunds(available+hold.Amount, amount, hold.Currency)
+		}
+		return Transaction{}, err
+	}
+
+	if _, err = tx.Exec(ctx, captureHoldQuery, hold.ID, amount, transaction.ID); err != nil {
+		return Transaction{}, err
+	}
+
+	return transaction, nil
+}
+
+func (s *Storage) ReleaseHold(ctx context.Context, id uuid.UUID) (hold Hold, err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return hold, err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	hold, err = s.scanHold(tx.QueryRow(ctx, lockHoldQuery, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Hold{}, NoHold(id)
+		}
+		return Hold{}, err
+	}
+
+	if err = checkHoldPending(hold); err != nil {
+		return Hold{}, err
+	}
+
+	if _, err = tx.Exec(ctx, releaseHoldQuery, id); err != nil {
+		return Hold{}, err
+	}
+
+	hold.Status = holdReleased
+
+	return hold, nil
+}
+
+// ExpireHolds marks pending holds past their expiration time as expired and
+// returns how many were expired.
+func (s *Storage) ExpireHolds(ctx context.Context) (int, error) {
+	tag, err := s.pool.Exec(ctx, expireHoldsQuery)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// ScheduleTransfer stores a transfer to be executed at transfer.ExecuteAt. A
+// retried request with the same idempotency key returns the stored transfer.
+func (s *Storage) ScheduleTransfer(ctx context.Context, transfer *TransactionRequest) (scheduled ScheduledTransfer, err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return scheduled, err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	replayID, err := claimScheduledIdempotencyKey(ctx, tx, transfer)
+	if err != nil {
+		return scheduled, err
+	}
+
+	if replayID != nil {
+		return s.scanScheduledTransfer(tx.QueryRow(ctx, scheduledTransferQuery, *replayID))
+	}
+
+	currency, err := s.transferCurrency(ctx, transfer.FromCardNumber, transfer.ToCardNumber, transfer.Currency, transfer.Convert)
+	if err != nil {
+		return scheduled, err
+	}
+
+	if err = tx.QueryRow(ctx, insertScheduledTransferQuery, transfer.UserID, s.keys.Index(cardIndex, transfer.FromCardNumber), s.keys.Index(cardIndex, transfer.ToCardNumber), transfer.Amount, currency, transfer.Convert, transfer.ExecuteAt).Scan(&scheduled.ID, &scheduled.CreatedAt); err != nil {
+		return ScheduledTransfer{}, err
+	}
+
+	if err = saveScheduledIdempotencyKey(ctx, tx, transfer, scheduled.ID); err != nil {
+		return ScheduledTransfer{}, err
+	}
+
+	scheduled.UserID = transfer.UserID
+	scheduled.FromCardNumber = transfer.FromCardNumber
+	scheduled.ToCardNumber = transfer.ToCardNumber
+	scheduled.Amount = transfer.Amount
+	scheduled.Currency = currency
+	scheduled.Convert = transfer.Convert
+	scheduled.ExecuteAt = *transfer.ExecuteAt
+	scheduled.Status = scheduledPending
+
+	return scheduled, nil
+}
+
+func (s *Storage) ScheduledTransferByID(ctx context.Context, id uuid.UUID) (ScheduledTransfer, error) {
+	scheduled, err := s.scanScheduledTransfer(s.pool.QueryRow(ctx, scheduledTransferQuery, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return scheduled, NoScheduledTransfer(id)
+		}
+		return scheduled, err
+	}
+
+	return scheduled, nil
+}
+
+func (s *Storage) CancelScheduledTransfer(ctx context.Context, id uuid.UUID) (ScheduledTransfer, error) {
+	scheduled, err := s.scanScheduledTransfer(s.pool.QueryRow(ctx, cancelScheduledTransferQuery, id))
+	if err == nil {
+		return scheduled, nil
+	}
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return scheduled, err
+	}
+
+	scheduled, err = s.ScheduledTransferByID(ctx, id)
+	if err != nil {
+		return scheduled, err
+	}
+
+	return ScheduledTransfer{}, ScheduledTransferNotPending(scheduled.Status)
+}
+
+// ClaimDueScheduledTransfers marks up to limit due transfers as processing and
+// returns them. Transfers stuck in processing longer than the claim timeout
+// are claimed again; the idempotency key keeps them from running twice.
+func (s *Storage) ClaimDueScheduledTransfers(ctx context.Context, limit int) ([]ScheduledTransfer, error) {
+	rows, err := s.pool.Query(ctx, claimScheduledTransfersQuery, limit, scheduledClaimTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []ScheduledTransfer
+	for rows.Next() {
+		scheduled, err := s.scanScheduledTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		transfers = append(transfers, scheduled)
+	}
+
+	return transfers, rows.Err()
+}
+
+func (s *Storage) FinishScheduledTransfer(ctx context.Context, scheduled *ScheduledTransfer) error {
+	_, err := s.pool.Exec(ctx, finishScheduledTransferQuery, scheduled.ID, scheduled.Status, scheduled.FailureReason, scheduled.TransactionID)
+	return err
+}
+
+func (s *Storage) CreateStandingOrder(ctx context.Context, order *StandingOrder) error {
+	currency, err := s.transferCurrency(ctx, order.FromCardNumber, order.ToCardNumber, order.Currency, order.Convert)
+	if err != nil {
+		return err
+	}
+
+	order.Currency = currency
+
+	return s.pool.QueryRow(ctx, insertStandingOrderQuery, order.UserID, s.keys.Index(cardIndex, order.FromCardNumber), s.keys.Index(cardIndex, order.ToCardNumber), order.Amount, order.Currency, order.Convert, order.Frequency, order.StartAt, order.EndAt, order.NextRunAt, order.MaxRetries).Scan(&order.ID, &order.CreatedAt)
+}
+
+func (s *Storage) StandingOrderByID(ctx context.Context, id uuid.UUID) (StandingOrder, error) {
+	order, err := s.scanStandingOrder(s.pool.QueryRow(ctx, standingOrderQuery, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return order, NoStandingOrder(id)
+		}
+		return order, err
+	}
+
+	return order, nil
+}
+
+func (s *Storage) StandingOrdersByUser(ctx context.Context, userID int) ([]StandingOrder, error) {
+	rows, err := s.pool.Query(ctx, standingOrdersByUserQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.scanStandingOrders(rows)
+}
+
+func (s *Storage) UpdateStandingOrder(ctx context.Context, update *StandingOrderUpdate) (StandingOrder, error) {
+	order, err := s.scanStandingOrder(s.pool.QueryRow(ctx, updateStandingOrderQuery, update.ID, update.Amount, update.EndAt))
+	if err == nil {
+		return order, nil
+	}
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return order, err
+	}
+
+	order, err = s.StandingOrderByID(ctx, update.ID)
+	if err != nil {
+		return order, err
+	}
+
+	return StandingOrder{}, StandingOrderNotActive(order.Status)
+}
+
+func (s *Storage) CancelStandingOrder(ctx context.Context, id uuid.UUID) (StandingOrder, error) {
+	order, err := s.scanStandingOrder(s.pool.QueryRow(ctx, cancelStandingOrderQuery, id))
+	if err == nil {
+		return order, nil
+	}
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return order, err
+	}
+
+	order, err = s.StandingOrderByID(ctx, id)
+	if err != nil {
+		return order, err
+	}
+
+	return StandingOrder{}, StandingOrderNotActive(order.Status)
+}
+
+// ClaimDueStandingOrders claims up to limit active orders whose next run is
+// due. The claim is released when the run is recorded or after a timeout.
+func (s *Storage) ClaimDueStandingOrders(ctx context.Context, limit int) ([]StandingOrder, error) {
+	rows, err := s.pool.Query(ctx, claimStandingOrdersQuery, limit, scheduledClaimTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.scanStandingOrders(rows)
+}
+
+// RecordStandingOrderRun stores the outcome of a run and the order's new
+// schedule in one transaction and releases the claim.
+func (s *Storage) RecordStandingOrderRun(ctx context.Context, order *StandingOrder, run *StandingOrderRun) (err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	if _, err = tx.Exec(ctx, insertStandingOrderRunQuery, order.ID, run.ScheduledFor, run.Attempt, run.Status, run.FailureReason, run.TransactionID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, advanceStandingOrderQuery, order.ID, order.Period, order.Attempts, order.NextRunAt, order.Status)
+	return err
+}
+
+func (s *Storage) StandingOrderRuns(ctx context.Context, id uuid.UUID) ([]StandingOrderRun, error) {
+	rows, err := s.pool.Query(ctx, standingOrderRunsQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []StandingOrderRun
+	for rows.Next() {
+		var run StandingOrderRun
+		if err := rows.Scan(&run.ID, &run.StandingOrderID, &run.ScheduledFor, &run.Attempt, &run.Status, &run.FailureReason, &run.TransactionID, &run.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+func (s *Storage) UserByID(ctx context.Context, id int) (user User, err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return user, err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	user, err = s.scanUser(tx.QueryRow(ctx, getUserByIDQuery, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return user, NoUser()
+		}
+		return user, err
+	}
+
+	rows, err := tx.Query(ctx, accountsByUserQuery, id)
+	if err != nil {
+		return user, err
+	}
+
+	user.Accounts, err = s.scanAccounts(rows)
+	if err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
+func (s *Storage) LimitsByAccount(ctx context.Context, id int) (limits AccountLimits, err error) {
+	if err = s.pool.QueryRow(ctx, accountLimitsQuery, id).Scan(&limits.TransactionLimit, &limits.DailyLimit, &limits.DailyCountLimit, &limits.Currency); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return limits, NoAccountID(id)
+		}
+		return limits, err
+	}
+
+	return limits, nil
+}
+
+func (s *Storage) UpdateLimits(ctx context.Context, id int, update *AccountLimits) (limits AccountLimits, err error) {
+	if err = s.pool.QueryRow(ctx, updateAccountLimitsQuery, id, update.TransactionLimit, update.DailyLimit, update.DailyCountLimit).Scan(&limits.TransactionLimit, &limits.DailyLimit, &limits.DailyCountLimit, &limits.Currency); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return limits, NoAccountID(id)
+		}
+		return limits, err
+	}
+
+	return limits, nil
+}
+
+// SetOverdraft grants, changes or, with a zero limit, revokes the overdraft
+// facility of the account and returns the account with its new limit and its
+// currency. The limit can't be lowered below the amount the account is
+// currently overdrawn by.
+func (s *Storage) SetOverdraft(ctx context.Context, id int, limit Money) (Account, error) {
+	account := Account{ID: id}
+	if err := s.pool.QueryRow(ctx, setOverdraftQuery, id, limit).Scan(&account.OverdraftLimit, &account.Currency); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Account{}, NoAccountID(id)
+		}
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == errCheckConstraintCode {
+			var balance Money
+			if err := s.pool.QueryRow(ctx, accountBalanceQuery, id).Scan(&balance); err != nil {
+				return Account{}, err
+			}
+			return Account{}, OverdraftInUse(balance)
+		}
+
+		return Account{}, err
+	}
+
+	return account, nil
+}
+
+func (s *Storage) InterestRates(ctx context.Context) ([]InterestRate, error) {
+	rows, err := s.pool.Query(ctx, interestRatesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []InterestRate
+
+	for rows.Next() {
+		var rate InterestRate
+		if err := rows.Scan(&rate.AccountType, &rate.AnnualRateBps); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+func (s *Storage) SetInterestRate(ctx context.Context, update *InterestRate) (rate InterestRate, err error) {
+	if err = s.pool.QueryRow(ctx, setInterestRateQuery, update.AccountType, update.AnnualRateBps).Scan(&rate.AccountType, &rate.AnnualRateBps); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return rate, NoAccountType(update.AccountType)
+		}
+		return rate, err
+	}
+
+	return rate, nil
+}
+
+func (s *Storage) ExchangeRates(ctx context.Context) ([]ExchangeRate, error) {
+	rows, err := s.pool.Query(ctx, exchangeRatesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []ExchangeRate
+	for rows.Next() {
+		var rate ExchangeRate
+		if err := rows.Scan(&rate.Base, &rate.Quote, &rate.Rate, &rate.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// SetExchangeRate creates or replaces the rate transfers from update.Base to
+// update.Quote are converted at.
+func (s *Storage) SetExchangeRate(ctx context.Context, update *ExchangeRate) (rate ExchangeRate, err error) {
+	if err = s.pool.QueryRow(ctx, setExchangeRateQuery, update.Base, update.Quote, update.Rate).Scan(&rate.Base, &rate.Quote, &rate.Rate, &rate.UpdatedAt); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == errForeignKeyConstraintCode {
+			if pgErr.ConstraintName == rateBaseConstraint {
+				return rate, UnsupportedCurrency(update.Base)
+			}
+			return rate, UnsupportedCurrency(update.Quote)
+		}
+		return rate, err
+	}
+
+	return rate, nil
+}
+
+// AccrueInterest records daily interest for every account up to and
+// including the given day. Days already accrued are skipped, so the job can
+// run any number of times.
+func (s *Storage) AccrueInterest(ctx context.Context, through time.Time) (err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	if _, err = tx.Exec(ctx, interestLockQuery); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, accrueInterestQuery, through); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, advanceAccrualQuery, through)
+	return err
+}
+
+// CapitalizeInterest posts the interest accrued before the given day as one
+// interest transaction per account and returns the number of transactions.
+// Accruals that round to less than a cent are carried over to the next run.
+func (s *Storage) CapitalizeInterest(ctx context.Context, before time.Time) (n int, err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	if _, err = tx.Exec(ctx, interestLockQuery); err != nil {
+		return 0, err
+	}
+
+	type credit struct {
+		accountID int
+		amount    Money
+		currency  string
+		cardID    int
+	}
+
+	rows, err := tx.Query(ctx, uncapitalizedInterestQuery, before)
+	if err != nil {
+		return 0, err
+	}
+
+	var credits []credit
+	for rows.Next() {
+		var c credit
+		if err = rows.Scan(&c.accountID, &c.amount, &c.currency, &c.cardID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		credits = append(credits, c)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(credits) == 0 {
+		return 0, nil
+	}
+
+	// Interest is paid out of the interest account of the credited account's
+	// currency.
+	interestAccountIDs := make(map[string]int)
+
+	for _, c := range credits {
+		interestAccountID, ok := interestAccountIDs[c.currency]
+		if !ok {
+			if err = tx.QueryRow(ctx, systemAccountQuery, interestAccount, c.currency).Scan(&interestAccountID); err != nil {
+				return 0, err
+			}
+			interestAccountIDs[c.currency] = interestAccountID
+		}
+
+		var (
+			transactionID uuid.UUID
+			createdAt     time.Time
+		)
+		if err = tx.QueryRow(ctx, insertInterestTransactionQuery, interestTransaction, c.amount, c.cardID, c.currency).Scan(&transactionID, &createdAt); err != nil {
+			return 0, err
+		}
+
+		if err = postEntries(ctx, tx, transactionID,
+			Posting{AccountID: interestAccountID, Amount: -c.amount},
+			Posting{AccountID: c.accountID, Amount: c.amount},
+		); err != nil {
+			return 0, err
+		}
+
+		if _, err = tx.Exec(ctx, capitalizeAccrualsQuery, c.accountID, transactionID, before); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(credits), nil
+}
+
+func (s *Storage) UserByPhoneNumber(ctx context.Context, phoneNumber string) (user User, err error) {
+	if err = s.pool.QueryRow(ctx, getUserByPhoneNumberQuery, s.keys.Index(phoneIndex, phoneNumber)).Scan(&user.ID, &user.PasswordHash, &user.Role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return user, NoUser()
+		}
+		return user, err
+	}
+
+	user.PhoneNumber = phoneNumber
+
+	return user, nil
+}
+
+func (s *Storage) CardOwner(ctx context.Context, cardNumber string) (userID int, err error) {
+	if err = s.pool.QueryRow(ctx, cardNumberQuery, s.keys.Index(cardIndex, cardNumber)).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, s.unavailableCard(ctx, s.pool, cardNumber)
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// CardExists reports whether a card with the number was ever issued,
+// whatever its status.
+func (s *Storage) CardExists(ctx context.Context, cardNumber string) (exists bool, err error) {
+	if err = s.pool.QueryRow(ctx, cardExistsQuery, s.keys.Index(cardIndex, cardNumber)).Scan(&exists); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (s *Storage) TransactionsByUser(ctx context.Context, id int) (transactions []Transaction, err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	rows, err := tx.Query(ctx, getTransactionsByUserQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		transaction, err := s.scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(transactions) == 0 {
+		return nil, NoUser()
+	}
+
+	return transactions, nil
+}
+
+func (s *Storage) Users(ctx context.Context) (users []User, err error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { err = rollback(ctx, tx, err) }()
+
+	rows, err := tx.Query(ctx, getUsersQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		user, err := s.scanUser(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(ctx, allAccountsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := s.scanAccounts(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := make(map[int][]Account)
+	for _, a := range accounts {
+		byUser[a.UserID] = append(byUser[a.UserID], a)
+	}
+
+	for i := range users {
+		users[i].Accounts = byUser[users[i].ID]
+	}
+
+	return users, nil
+}
+
+// Reencrypt seals rows still holding plaintext PII, replaces card numbers
+// kept by transactions, holds, scheduled transfers and standing orders with
+// references to the cards, and rewraps the data keys of rows sealed under a
+// key other than the active one. It works in batches and returns the number
+// of rows changed.
+func (s *Storage) Reencrypt(ctx context.Context, batchSize int) (n int, err error) {
+	for _, step := range []func(context.Context, int) (int, error){
+		s.sealPlaintextUsers,
+		s.sealPlaintextCards,
+		s.referenceCards(plaintextTransactionCardsQuery, referenceTransactionCardsQuery),
+		s.referenceCards(plaintextHoldCardsQuery, referenceHoldCardsQuery),
+		s.referenceCards(plaintextScheduledTransferCardsQuery, referenceScheduledTransferCardsQuery),
+		s.referenceCards(plaintextStandingOrderCardsQuery, referenceStandingOrderCardsQuery),
+		s.rewrapKeys(staleUserKeysQuery, rewrapUserQuery),
+		s.rewrapKeys(staleCardKeysQuery, rewrapCardQuery),
+	} {
+		for {
+			changed, err := step(ctx, batchSize)
+			if err != nil {
+				return n, err
+			}
+			if changed == 0 {
+				break
+			}
+			n += changed
+		}
+	}
+
+	return n, nil
+}
+
+func (s *Storage) sealPlaintextUsers(ctx context.Context, limit int) (int, error) {
+	type plaintextUser struct {
+		id                               int
+		firstName, lastName, phoneNumber string
+	}
+
+	rows, err := s.pool.Query(ctx, plaintextUsersQuery, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var users []plaintextUser
+	for rows.Next() {
+		var u plaintextUser
+		if err := rows.Scan(&u.id, &u.firstName, &u.lastName, &u.phoneNumber); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, u := range users {
+		keyID, dek, sealed, err := s.keys.Seal(u.firstName, u.lastName, u.phoneNumber)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := s.pool.Exec(ctx, sealUserQuery, u.id, keyID, dek, sealed[0], sealed[1], sealed[2], s.keys.Index(phoneIndex, u.phoneNumber)); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(users), nil
+}
+
+func (s *Storage) sealPlaintextCards(ctx context.Context, limit int) (int, error) {
+	type plaintextCard struct {
+		id     int
+		number string
+	}
+
+	rows, err := s.pool.Query(ctx, plaintextCardsQuery, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var cards []plaintextCard
+	for rows.Next() {
+		var c plaintextCard
+		if err := rows.Scan(&c.id, &c.number); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		cards = append(cards, c)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, c := range cards {
+		keyID, dek, sealed, err := s.keys.Seal(c.number)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := s.pool.Exec(ctx, sealCardQuery, c.id, keyID, dek, sealed[0], s.keys.Index(cardIndex, c.number)); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(cards), nil
+}
+
+// rewrapKeys returns a step that moves a batch of data keys in one table onto
+// the active key. The update only applies if the row's key is unchanged.
+func (s *Storage) rewrapKeys(staleQuery, rewrapQuery string) func(context.Context, int) (int, error) {
+	return func(ctx context.Context, limit int) (int, error) {
+		type wrappedKey struct {
+			id    int
+			keyID string
+			dek   []byte
+		}
+
+		rows, err := s.pool.Query(ctx, staleQuery, s.keys.ActiveID(), limit)
+		if err != nil {
+			return 0, err
+		}
+
+		var keys []wrappedKey
+		for rows.Next() {
+			var k wrappedKey
+			if err := rows.Scan(&k.id, &k.keyID, &k.dek); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			keys = append(keys, k)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		for _, k := range keys {
+			keyID, dek, err := s.keys.Rewrap(k.keyID, k.dek)
+			if err != nil {
+				return 0, fmt.Errorf("row %d: %s", k.id, err)
+			}
+
+			if _, err := s.pool.Exec(ctx, rewrapQuery, k.id, k.keyID, keyID, dek); err != nil {
+				return 0, err
+			}
+		}
+
+		return len(keys), nil
+	}
+}
+
+// referenceCards replaces the pair of card numbers of rows selected by
+// plaintextQuery with references to their cards. It runs after the cards
+// are sealed, since the cards are found by blind index; a number matching
+// no card is dropped.
+func (s *Storage) referenceCards(plaintextQuery, referenceQuery string) func(context.Context, int) (int, error) {
+	return func(ctx context.Context, limit int) (int, error) {
+		type plaintextRow struct {
+			id                    uuid.UUID
+			firstCard, secondCard *string
+		}
+
+		rows, err := s.pool.Query(ctx, plaintextQuery, limit)
+		if err != nil {
+			return 0, err
+		}
+
+		var plaintext []plaintextRow
+		for rows.Next() {
+			var r plaintextRow
+			if err := rows.Scan(&r.id, &r.firstCard, &r.secondCard); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			plaintext = append(plaintext, r)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		index := func(cardNumber *string) *string {
+			if cardNumber == nil {
+				return nil
+			}
+			return s.cardNumberIndex(*cardNumber)
+		}
+
+		for _, r := range plaintext {
+			if _, err := s.pool.Exec(ctx, referenceQuery, r.id, index(r.firstCard), index(r.secondCard)); err != nil {
+				return 0, err
+			}
+		}
+
+		return len(plaintext), nil
+	}
+}
+
+func (s *Storage) insertAccount(ctx context.Context, tx pgx.Tx, userID int, account *Account) error {
+	if err := tx.QueryRow(ctx, insertAccountQuery, userID, account.Balance, account.Type, account.Currency).Scan(&account.ID); err != nil {
+		return err
+	}
+
+	for i := range account.Cards {
+		if err := s.insertCard(ctx, tx, account.ID, &account.Cards[i]); err != nil {
+			return err
+		}
+	}
+
+	account.UserID = userID
+
+	return nil
+}
+
+// insertCard inserts the card under a savepoint and generates a new number
+// when the current one collides with an existing card.
+func (s *Storage) insertCard(ctx context.Context, tx pgx.Tx, accountID int, card *Card) error {
+	for attempt := 1; ; attempt++ {
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return err
+		}
+
+		keyID, dek, sealed, err := s.keys.Seal(card.Number)
+		if err != nil {
+			sp.Rollback(ctx)
+			return err
+		}
+
+		var cvvHash string
+		if card.CVV != "" {
+			cvvHash = s.hashCVV(card.Number, card.CVV)
+		}
+
+		err = sp.QueryRow(ctx, insertCardQuery, accountID, keyID, dek, sealed[0], s.keys.Index(cardIndex, card.Number), cvvHash, card.ExpireTime, card.Kind, card.Status).Scan(&card.ID)
+		if err == nil {
+			return sp.Commit(ctx)
+		}
+
+		if rbErr := sp.Rollback(ctx); rbErr != nil {
+			return rbErr
+		}
+
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.ConstraintName != cardNumberConstraint || attempt == cardNumberAttempts {
+			return err
+		}
+
+		card.Number = newCardNumber()
+	}
+}
+
+// scanAccounts reads one row per card ordered by account and folds the
+// cards into their accounts.
+func (s *Storage) scanAccounts(rows pgx.Rows) ([]Account, error) {
+	defer rows.Close()
+
+	var accounts []Account
+
+	for rows.Next() {
+		var (
+			a      Account
+			c      Card
+			keyID  string
+			dek    []byte
+			number []byte
+		)
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Balance, &a.AvailableBalance, &a.OverdraftLimit, &a.Currency, &a.Type, &c.ID, &keyID, &dek, &number, &c.ExpireTime, &c.Kind, &c.Status); err != nil {
+			return nil, err
+		}
+
+		fields, err := s.keys.Open(keyID, dek, number)
+		if err != nil {
+			return nil, err
+		}
+		c.Number = fields[0]
+
+		if n := len(accounts); n > 0 && accounts[n-1].ID == a.ID {
+			accounts[n-1].Cards = append(accounts[n-1].Cards, c)
+			continue
+		}
+
+		a.Cards = []Card{c}
+		accounts = append(accounts, a)
+	}
+
+	return accounts, rows.Err()
+}
+
+func (s *Storage) scanCard(row pgx.Row) (Card, error) {
+	var (
+		c      Card
+		keyID  string
+		dek    []byte
+		number []byte
+	)
+	if err := row.Scan(&c.ID, &keyID, &dek, &number, &c.ExpireTime, &c.Kind, &c.Status, &c.AccountID); err != nil {
+		return c, err
+	}
+
+	fields, err := s.keys.Open(keyID, dek, number)
+	if err != nil {
+		return c, err
+	}
+	c.Number = fields[0]
+
+	return c, nil
+}
+
+// scanUser reads a user row and opens its sealed fields.
+func (s *Storage) scanUser(row pgx.Row) (User, error) {
+	var (
+		u      User
+		keyID  string
+		dek    []byte
+		sealed = make([][]byte, 3)
+	)
+	if err := row.Scan(&u.ID, &keyID, &dek, &sealed[0], &sealed[1], &sealed[2], &u.Role, &u.CreatedAt); err != nil {
+		return u, err
+	}
+
+	fields, err := s.keys.Open(keyID, dek, sealed...)
+	if err != nil {
+		return u, err
+	}
+	u.FirstName, u.LastName, u.PhoneNumber = fields[0], fields[1], fields[2]
+
+	return u, nil
+}
+
+// hashCVV returns the keyed hash a CVV is stored as. It is bound to the card
+// number so equal CVVs on different cards don't share a hash.
+func (s *Storage) hashCVV(cardNumber, cvv string) string {
+	mac := hmac.New(sha256.New, s.cvvKey)
+	mac.Write([]byte(cardNumber + ":" + cvv))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// unavailableCard explains why a lookup of a usable card found nothing: the
+// card isn't active, has expired or doesn't exist.
+func (s *Storage) unavailableCard(ctx context.Context, q querier, cardNumber string) error {
+	var (
+		status  string
+		expired bool
+	)
+	if err := q.QueryRow(ctx, cardStatusQuery, s.keys.Index(cardIndex, cardNumber)).Scan(&status, &expired); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return NoAccount(cardNumber)
+		}
+		return err
+	}
+
+	if status == cardActive && expired {
+		return CardExpired(cardNumber)
+	}
+
+	return CardNotActive(cardNumber, status)
+}
+
+// transferCurrency checks that a transfer between the two cards can be made
+// and returns the currency it is made in: the sender's, which the requested
+// currency has to match when given. A recipient in another currency requires
+// conversion.
+func (s *Storage) transferCurrency(ctx context.Context, fromCardNumber, toCardNumber, currency string, convert bool) (string, error) {
+	currencies := make([]string, 2)
+
+	for i, cardNumber := range []string{fromCardNumber, toCardNumber} {
+		var accountID int
+		if err := s.pool.QueryRow(ctx, accountIDQuery, s.keys.Index(cardIndex, cardNumber)).Scan(&accountID, &currencies[i]); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return "", s.unavailableCard(ctx, s.pool, cardNumber)
+			}
+			return "", err
+		}
+	}
+
+	if err := checkCurrency(fromCardNumber, currencies[0], currency); err != nil {
+		return "", err
+	}
+
+	if currencies[0] != currencies[1] && !convert {
+		return "", ConversionRequired(currencies[0], currencies[1])
+	}
+
+	return currencies[0], nil
+}
+
+func (s *Storage) scanCards(rows pgx.Rows) ([]Card, error) {
+	defer rows.Close()
+
+	var cards []Card
+
+	for rows.Next() {
+		var (
+			c      Card
+			keyID  string
+			dek    []byte
+			number []byte
+		)
+		if err := rows.Scan(&c.ID, &keyID, &dek, &number, &c.ExpireTime, &c.Kind, &c.Status); err != nil {
+			return nil, err
+		}
+
+		fields, err := s.keys.Open(keyID, dek, number)
+		if err != nil {
+			return nil, err
+		}
+		c.Number = fields[0]
+
+		cards = append(cards, c)
+	}
+
+	return cards, rows.Err()
+}
+
+func (s *Storage) insertDepositTransaction(ctx context.Context, tx pgx.Tx, tr *TransactionRequest, currency string) (Transaction, error) {
+	var (
+		transactionID uuid.UUID
+		createdAt     time.Time
+	)
+
+	if err := tx.QueryRow(ctx, insertDepositTransactionQuery, tr.Type, tr.Amount, s.keys.Index(cardIndex, tr.ToCardNumber), currency).Scan(&transactionID, &createdAt); err != nil {
+		return Transaction{}, err
+	}
+
+	transaction := Transaction{
+		ID:           transactionID,
+		Type:         tr.Type,
+		Amount:       tr.Amount,
+		Currency:     currency,
+		ToCardNumber: tr.ToCardNumber,
+		CreatedAt:    createdAt,
+	}
+
+	return transaction, nil
+}
+
+func (s *Storage) insertTransferTransaction(ctx context.Context, tx pgx.Tx, tr *TransactionRequest, currency string, conversion *Conversion) (Transaction, error) {
+	var (
+		transactionID uuid.UUID
+		createdAt     time.Time
+	)
+
+	convertedAmount, convertedCurrency, exchangeRate := conversionColumns(conversion)
+
+	if err := tx.QueryRow(ctx, insertTransferTransactionQuery, tr.Type, tr.Amount, s.keys.Index(cardIndex, tr.ToCardNumber), s.keys.Index(cardIndex, tr.FromCardNumber), currency, convertedAmount, convertedCurrency, exchangeRate).Scan(&transactionID, &createdAt); err != nil {
+		return Transaction{}, err
+	}
+
+	transaction := Transaction{
+		ID:             transactionID,
+		Type:           tr.Type,
+		Amount:         tr.Amount,
+		Currency:       currency,
+		Conversion:     conversion,
+		FromCardNumber: tr.FromCardNumber,
+		ToCardNumber:   tr.ToCardNumber,
+		CreatedAt:      createdAt,
+	}
+
+	return transaction, nil
+
+}
+
+func (s *Storage) insertWithdrawalTransaction(ctx context.Context, tx pgx.Tx, tr *TransactionRequest, currency string) (Transaction, error) {
+	var (
+		transactionID uuid.UUID
+		createdAt     time.Time
+	)
+
+	if err := tx.QueryRow(ctx, insertWithdrawalTransactionQuery, tr.Type, tr.Amount, s.keys.Index(cardIndex, tr.FromCardNumber), currency).Scan(&transactionID, &createdAt); err != nil {
+		return Transaction{}, err
+	}
+
+	transaction := Transaction{
+		ID:             transactionID,
+		Type:           tr.Type,
+		Amount:         tr.Amount,
+		Currency:       currency,
+		FromCardNumber: tr.FromCardNumber,
+		CreatedAt:      createdAt,
+	}
+
+	return transaction, nil
+}
+
+func postingsByTransaction(ctx context.Context, tx pgx.Tx, transactionID uuid.UUID) ([]Posting, error) {
+	rows, err := tx.Query(ctx, postingsByTransactionQuery, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var postings []Posting
+	for rows.Next() {
+		var p Posting
+		if err := rows.Scan(&p.AccountID, &p.Amount); err != nil {
+			return nil, err
+		}
+
+		postings = append(postings, p)
+	}
+
+	return postings, rows.Err()
+}
+
+// lockAccountsByID locks the accounts in id order and returns the available
+// balances and currencies of the customer accounts among them.
+func lockAccountsByID(ctx context.Context, tx pgx.Tx, accountIDs []int) (map[int]Account, error) {
+	rows, err := tx.Query(ctx, lockAccountsByIDQuery, accountIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make(map[int]Account)
+	for rows.Next() {
+		var (
+			account  Account
+			isSystem bool
+		)
+		if err := rows.Scan(&account.ID, &account.AvailableBalance, &account.Currency, &isSystem); err != nil {
+			return nil, err
+		}
+
+		if !isSystem {
+			accounts[account.ID] = account
+		}
+	}
+
+	return accounts, rows.Err()
+}
+
+// newConversion builds the conversion of a transaction from its nullable
+// columns, which are all set or all NULL.
+func newConversion(amount *Money, currency, rate *string) *Conversion {
+	if amount == nil {
+		return nil
+	}
+
+	return &Conversion{
+		Amount:   *amount,
+		Currency: *currency,
+		Rate:     *rate,
+	}
+}
+
+// conversionColumns is the inverse of newConversion.
+func conversionColumns(c *Conversion) (*Money, *string, *string) {
+	if c == nil {
+		return nil, nil, nil
+	}
+
+	return &c.Amount, &c.Currency, &c.Rate
+}
+
+// sealedCardNumber is the sealed number of a card joined into a row. Its
+// columns are NULL when the row references no card.
+type sealedCardNumber struct {
+	keyID  *string
+	dek    []byte
+	number []byte
+}
+
+// openCardNumbers opens the sealed numbers into the matching card numbers,
+// leaving the ones without a card empty.
+func (s *Storage) openCardNumbers(sealed []sealedCardNumber, cardNumbers ...*string) error {
+	for i, c := range sealed {
+		if c.keyID == nil {
+			continue
+		}
+
+		fields, err := s.keys.Open(*c.keyID, c.dek, c.number)
+		if err != nil {
+			return err
+		}
+		*cardNumbers[i] = fields[0]
+	}
+
+	return nil
+}
+
+// cardNumberIndex returns the blind index of the card number, or nil when
+// there is no card.
+func (s *Storage) cardNumberIndex(cardNumber string) *string {
+	if cardNumber == "" {
+		return nil
+	}
+
+	index := s.keys.Index(cardIndex, cardNumber)
+	return &index
+}
+
+func (s *Storage) scanTransaction(row pgx.Row) (Transaction, error) {
+	var (
+		transaction       Transaction
+		convertedAmount   *Money
+		convertedCurrency *string
+		exchangeRate      *string
+		to, from          sealedCardNumber
+	)
+	if err := row.Scan(&transaction.ID, &transaction.Type, &transaction.Amount, &transaction.Currency, &convertedAmount, &convertedCurrency, &exchangeRate, &to.keyID, &to.dek, &to.number, &from.keyID, &from.dek, &from.number, &transaction.ReversalOf, &transaction.CreatedAt); err != nil {
+		return transaction, err
+	}
+
+	transaction.Conversion = newConversion(convertedAmount, convertedCurrency, exchangeRate)
+
+	err := s.openCardNumbers([]sealedCardNumber{to, from}, &transaction.ToCardNumber, &transaction.FromCardNumber)
+
+	return transaction, err
+}
+
+func (s *Storage) scanHold(row pgx.Row) (Hold, error) {
+	var (
+		hold           Hold
+		card, merchant sealedCardNumber
+	)
+	if err := row.Scan(&hold.ID, &card.keyID, &card.dek, &card.number, &merchant.keyID, &merchant.dek, &merchant.number, &hold.Amount, &hold.CapturedAmount, &hold.Currency, &hold.Status, &hold.TransactionID, &hold.ExpiresAt, &hold.CreatedAt); err != nil {
+		return hold, err
+	}
+
+	err := s.openCardNumbers([]sealedCardNumber{card, merchant}, &hold.CardNumber, &hold.MerchantCardNumber)
+
+	return hold, err
+}
+
+func (s *Storage) scanScheduledTransfer(row pgx.Row) (ScheduledTransfer, error) {
+	var (
+		scheduled ScheduledTransfer
+		from, to  sealedCardNumber
+	)
+	if err := row.Scan(&scheduled.ID, &scheduled.UserID, &from.keyID, &from.dek, &from.number, &to.keyID, &to.dek, &to.number, &scheduled.Amount, &scheduled.Currency, &scheduled.Convert, &scheduled.ExecuteAt, &scheduled.Status, &scheduled.FailureReason, &scheduled.TransactionID, &scheduled.ExecutedAt, &scheduled.CreatedAt); err != nil {
+		return scheduled, err
+	}
+
+	err := s.openCardNumbers([]sealedCardNumber{from, to}, &scheduled.FromCardNumber, &scheduled.ToCardNumber)
+
+	return scheduled, err
+}
+
+func (s *Storage) scanStandingOrder(row pgx.Row) (StandingOrder, error) {
+	var (
+		order    StandingOrder
+		from, to sealedCardNumber
+	)
+	if err := row.Scan(&order.ID, &order.UserID, &from.keyID, &from.dek, &from.number, &to.keyID, &to.dek, &to.number, &order.Amount, &order.Currency, &order.Convert, &order.Frequency, &order.StartAt, &order.EndAt, &order.NextRunAt, &order.Period, &order.Attempts, &order.MaxRetries, &order.Status, &order.CreatedAt); err != nil {
+		return order, err
+	}
+
+	err := s.openCardNumbers([]sealedCardNumber{from, to}, &order.FromCardNumber, &order.ToCardNumber)
+
+	return order, err
+}
+
+func (s *Storage) scanStandingOrders(rows pgx.Rows) ([]StandingOrder, error) {
+	defer rows.Close()
+
+	var orders []StandingOrder
+	for rows.Next() {
+		order, err := s.scanStandingOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// checkHoldPending reports whether the hold can still be captured or released.
+// Expired holds no longer reserve funds even before the sweeper marks them.
+func checkHoldPending(hold Hold) error {
+	if hold.Status != holdPending {
+		return HoldNotPending(hold.Status)
+	}
+
+	if !hold.ExpiresAt.After(time.Now()) {
+		return HoldNotPending(holdExpired)
+	}
+
+	return nil
+}
+
+// postEntries journals a balanced set of postings for the transaction and
+// applies them to the cached account balances.
+func postEntries(ctx context.Context, tx pgx.Tx, transactionID uuid.UUID, postings ...Posting) error {
+	var sum Money
+	for _, p := range postings {
+		sum += p.Amount
+	}
+
+	if sum != 0 {
+		return fmt.Errorf("unbalanced postings for transaction %s: sum = %s", transactionID, sum)
+	}
+
+	for _, p := range postings {
+		if _, err := tx.Exec(ctx, insertPostingQuery, transactionID, p.AccountID, p.Amount); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, applyPostingQuery, p.AccountID, p.Amount); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkCurrency reports whether a transaction in the given currency can be
+// made on the card's account. An empty currency means the account's own.
+func checkCurrency(cardNumber, accountCurrency, currency string) error {
+	if currency != "" && currency != accountCurrency {
+		return CurrencyMismatch(cardNumber, accountCurrency, currency)
+	}
+
+	return nil
+}
+
+// convert converts amount from one currency to another at the current
+// exchange rate and returns the postings of the transfer: the sender pays
+// amount into the fx account of its currency and the recipient is paid the
+// converted amount out of the fx account of its own, so the postings of each
+// currency balance on their own.
+func convert(ctx context.Context, tx pgx.Tx, fromAccountID, toAccountID int, amount Money, from, to string) (*Conversion, []Posting, error) {
+	conversion := &Conversion{Currency: to}
+	if err := tx.QueryRow(ctx, exchangeRateQuery, from, to, amount).Scan(&conversion.Rate, &conversion.Amount); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, NoExchangeRate(from, to)
+		}
+		return nil, nil, err
+	}
+
+	if conversion.Amount <= 0 {
+		return nil, nil, AmountTooSmallToConvert(amount, from)
+	}
+
+	var fromFXAccountID, toFXAccountID int
+	if err := tx.QueryRow(ctx, systemAccountQuery, fxAccount, from).Scan(&fromFXAccountID); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.QueryRow(ctx, systemAccountQuery, fxAccount, to).Scan(&toFXAccountID); err != nil {
+		return nil, nil, err
+	}
+
+	postings := []Posting{
+		{AccountID: fromAccountID, Amount: -amount},
+		{AccountID: fromFXAccountID, Amount: amount},
+		{AccountID: toFXAccountID, Amount: -conversion.Amount},
+		{AccountID: toAccountID, Amount: conversion.Amount},
+	}
+
+	return conversion, postings, nil
+}
+
+// checkLimits enforces the account's limits on every debit. The account must be
+// locked by tx so concurrent debits cannot both pass the daily checks.
+func checkLimits(ctx context.Context, tx pgx.Tx, accountID int, amount Money) error {
+	var limits AccountLimits
+	if err := tx.QueryRow(ctx, accountLimitsQuery, accountID).Scan(&limits.TransactionLimit, &limits.DailyLimit, &limits.DailyCountLimit, &limits.Currency); err != nil {
+		return err
+	}
+
+	if amount > limits.TransactionLimit {
+		return LimitExceeded("transaction", limits.TransactionLimit.String(), amount.String())
+	}
+
+	var (
+		spent Money
+		count int
+	)
+	if err := tx.QueryRow(ctx, dailyOutgoingQuery, accountID).Scan(&spent, &count); err != nil {
+		return err
+	}
+
+	if spent+amount > limits.DailyLimit {
+		return LimitExceeded("daily amount", limits.DailyLimit.String(), (spent + amount).String())
+	}
+
+	if count+1 > limits.DailyCountLimit {
+		return LimitExceeded("daily count", strconv.Itoa(limits.DailyCountLimit), strconv.Itoa(count+1))
+	}
+
+	return nil
+}
+
+// claimIdempotencyKey reserves the request's idempotency key inside tx. A
+// concurrent request with the same key blocks until tx finishes. If the key
+// was already used for the same request, the stored transaction is returned.
+func (s *Storage) claimIdempotencyKey(ctx context.Context, tx pgx.Tx, tr *TransactionRequest) (*Transaction, error) {
+	record, err := claimIdempotencyRecord(ctx, tx, tr)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	if record.transactionID == nil {
+		return nil, IdempotencyKeyReused()
+	}
+
+	stored, err := s.scanTransaction(tx.QueryRow(ctx, transactionByIDQuery, *record.transactionID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
+
+// claimScheduledIdempotencyKey is claimIdempotencyKey for scheduled transfers,
+// it returns the id of the scheduled transfer stored for a retried request.
+func claimScheduledIdempotencyKey(ctx context.Context, tx pgx.Tx, tr *TransactionRequest) (*uuid.UUID, error) {
+	record, err := claimIdempotencyRecord(ctx, tx, tr)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	if record.scheduledTransferID == nil {
+		return nil, IdempotencyKeyReused()
+	}
+
+	return record.scheduledTransferID, nil
+}
+
+type idempotencyRecord struct {
+	transactionID       *uuid.UUID
+	scheduledTransferID *uuid.UUID
+}
+
+// claimIdempotencyRecord returns nil when the key was claimed by this request
+// and the stored result when it was claimed by an earlier one.
+func claimIdempotencyRecord(ctx context.Context, tx pgx.Tx, tr *TransactionRequest) (*idempotencyRecord, error) {
+	if tr.IdempotencyKey == "" {
+		return nil, nil
+	}
+
+	fingerprint := tr.Fingerprint()
+
+	tag, err := tx.Exec(ctx, claimIdempotencyKeyQuery, tr.UserID, tr.IdempotencyKey, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	if tag.RowsAffected() == 1 {
+		return nil, nil
+	}
+
+	var (
+		requestHash string
+		record      idempotencyRecord
+	)
+
+	if err := tx.QueryRow(ctx, getIdempotencyKeyQuery, tr.UserID, tr.IdempotencyKey).Scan(&requestHash, &record.transactionID, &record.scheduledTransferID); err != nil {
+		return nil, err
+	}
+
+	if requestHash != fingerprint {
+		return nil, IdempotencyKeyReused()
+	}
+
+	return &record, nil
+}
+
+func saveIdempotencyKey(ctx context.Context, tx pgx.Tx, tr *TransactionRequest, transaction Transaction) error {
+	if tr.IdempotencyKey == "" {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, saveIdempotencyKeyQuery, tr.UserID, tr.IdempotencyKey, transaction.ID)
+	return err
+}
+
+func saveScheduledIdempotencyKey(ctx context.Context, tx pgx.Tx, tr *TransactionRequest, id uuid.UUID) error {
+	if tr.IdempotencyKey == "" {
+		return nil
+	}
 
+	_, err := tx.Exec(ctx, saveScheduledIdempotencyKeyQuery, tr.UserID, tr.IdempotencyKey, id)
+	return err
 }
 
 func rollback(ctx context.Context, tx pgx.Tx, err error) error {
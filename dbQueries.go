@@ -1,94 +1,536 @@
 package main
 
 var (
-	balanceQuery = `SELECT balance 
+	balanceQuery = `SELECT accounts.id, balance + overdraft_limit - held_amount(accounts.id), accounts.currency
 					FROM accounts 
 					JOIN users ON accounts.user_id = users.id
 					JOIN cards ON accounts.id = cards.account_id
-					WHERE card_number = $1;`
+					WHERE cards.card_number_index = $1 AND cards.status = 'active' AND cards.expire_time >= CURRENT_DATE;`
+
+	accountIDQuery = `SELECT accounts.id, accounts.currency
+					  FROM accounts
+					  JOIN users ON accounts.user_id = users.id
+					  JOIN cards ON accounts.id = cards.account_id
+					  WHERE cards.card_number_index = $1 AND cards.status = 'active' AND cards.expire_time >= CURRENT_DATE;`
+
+	systemAccountQuery = `SELECT id FROM accounts WHERE system_name = $1 AND currency = $2;`
+
+	exchangeRateQuery = `SELECT rate::TEXT, ROUND($3::BIGINT * rate)::BIGINT
+						 FROM exchange_rates
+						 WHERE base = $1 AND quote = $2;`
+
+	exchangeRatesQuery = `SELECT base, quote, rate::TEXT, updated_at FROM exchange_rates ORDER BY base, quote;`
+
+	setExchangeRateQuery = `INSERT INTO exchange_rates(base, quote, rate)
+							VALUES($1, $2, $3::NUMERIC)
+							ON CONFLICT (base, quote) DO UPDATE SET rate = EXCLUDED.rate, updated_at = NOW()
+							RETURNING base, quote, rate::TEXT, updated_at;`
+
+	insertPostingQuery = `INSERT INTO postings(transaction_id, account_id, amount)
+						  VALUES($1, $2, $3);`
+
+	applyPostingQuery = `UPDATE accounts
+						 SET balance = balance + $2
+						 WHERE id = $1 AND system_name IS NULL;`
+
+	lockAccountsQuery = `SELECT accounts.id
+						 FROM accounts
+						 JOIN cards ON accounts.id = cards.account_id
+						 WHERE cards.card_number_index IN ($1, $2) AND cards.status = 'active' AND cards.expire_time >= CURRENT_DATE
+						 ORDER BY accounts.id
+						 FOR UPDATE OF accounts;`
 
 	cardNumberQuery = `SELECT users.id 
 					   FROM users 
 					   JOIN accounts ON users.id = accounts.user_id
 					   JOIN cards ON accounts.id = cards.account_id 
-					   WHERE cards.card_number = $1;`
-
-	transferQuery = `UPDATE accounts 
-					 SET balance = 
-					 CASE 
-					 	WHEN accounts.id = (SELECT cards.account_id FROM cards WHERE cards.card_number = $1) THEN balance - $2 
-						WHEN accounts.id = (SELECT cards.account_id FROM cards WHERE cards.card_number = $3) THEN balance + $2 
-						ELSE balance
-					 END 
-					 WHERE accounts.id IN (
-					 (SELECT cards.account_id FROM cards WHERE cards.card_number = $1),
-					 (SELECT cards.account_id FROM cards WHERE cards.card_number = $3)
-					 );`
-
-	insertTransferTransactionQuery = `WITH from_card_number_transfer AS (
-									  SELECT accounts.id FROM accounts 
-									  JOIN users ON accounts.user_id = users.id 
-									  JOIN cards ON accounts.id = cards.account_id
-	  								  WHERE cards.card_number = $1
-	  								  ), 
-	                                  to_card_number_transfer AS (
-									  SELECT accounts.id FROM accounts 
-	                                  JOIN users ON accounts.user_id = users.id 
-									  JOIN cards ON accounts.id = cards.account_id
-	                                  WHERE cards.card_number = $2
-	                                  ), 
-									  insert_transaction AS (
-									  INSERT INTO transactions(account_id, transaction_type, amount, to_card_number, from_card_number) 
-									  VALUES((SELECT id FROM from_card_number_transfer), $3, $4, $1, $2) RETURNING transaction_id) 
-									  INSERT INTO transactions(transaction_id, account_id, transaction_type, amount, to_card_number, from_card_number) 
-								      VALUES((SELECT transaction_id FROM insert_transaction), (SELECT id FROM to_card_number_transfer), $3, $4, $1, $2) RETURNING transaction_id, created_at;`
-
-	getTransactionsByUserQuery = `SELECT transaction_id, transaction_type, amount, to_card_number, from_card_number, transactions.created_at FROM transactions
-								  JOIN accounts ON transactions.account_id = accounts.id
-								  JOIN users ON accounts.user_id = users.id
-							      WHERE users.id = $1 
-							      ORDER BY created_at DESC;`
-
-	insertUserQuery = `WITH new_user AS (
-					   INSERT INTO users(first_name, last_name, phone_number, password_hash)
-					   VALUES($1, $2, $3, $4)
-					   RETURNING id
-					   ),
-					   new_account AS (
-					   INSERT INTO accounts(user_id, balance)
-					   VALUES((SELECT id FROM new_user), $5)
-					   RETURNING id
-					   )
-					   INSERT INTO cards(account_id, card_number, cvv, expire_time)
-					   VALUES((SELECT id from new_account), $6, $7, $8) RETURNING account_id;`
-
-	getUserByIDQuery = `SELECT users.id, users.first_name, users.last_name, users.phone_number, users.created_at, accounts.id, accounts.balance, cards.id, cards.card_number, cards.cvv, cards.expire_time
+					   WHERE cards.card_number_index = $1 AND cards.status = 'active' AND cards.expire_time >= CURRENT_DATE;`
+
+	// Cards are referenced by id, found by the blind indexes of their numbers.
+	insertTransferTransactionQuery = `INSERT INTO transactions(transaction_type, amount, to_card_id, from_card_id, currency, converted_amount, converted_currency, exchange_rate)
+									  VALUES($1, $2, (SELECT id FROM cards WHERE card_number_index = $3), (SELECT id FROM cards WHERE card_number_index = $4), $5, $6, $7, $8::NUMERIC)
+									  RETURNING transaction_id, created_at;`
+
+	getTransactionsByUserQuery = `SELECT transactions.transaction_id, transactions.transaction_type, transactions.amount, transactions.currency, transactions.converted_amount, transactions.converted_currency, transactions.exchange_rate::TEXT,
+								  to_card.key_id, to_card.dek, to_card.card_number_enc, from_card.key_id, from_card.dek, from_card.card_number_enc, transactions.reversal_of, transactions.created_at
+								  FROM transactions
+								  LEFT JOIN cards AS to_card ON transactions.to_card_id = to_card.id
+								  LEFT JOIN cards AS from_card ON transactions.from_card_id = from_card.id
+								  WHERE transactions.transaction_id IN (
+								  SELECT postings.transaction_id FROM postings
+								  JOIN accounts ON postings.account_id = accounts.id
+								  WHERE accounts.user_id = $1
+								  )
+								  ORDER BY transactions.created_at DESC;`
+
+	transactionByIDQuery = `SELECT transactions.transaction_id, transactions.transaction_type, transactions.amount, transactions.currency, transactions.converted_amount, transactions.converted_currency, transactions.exchange_rate::TEXT,
+							to_card.key_id, to_card.dek, to_card.card_number_enc, from_card.key_id, from_card.dek, from_card.card_number_enc, transactions.reversal_of, transactions.created_at
+							FROM transactions
+							LEFT JOIN cards AS to_card ON transactions.to_card_id = to_card.id
+							LEFT JOIN cards AS from_card ON transactions.from_card_id = from_card.id
+							WHERE transactions.transaction_id = $1;`
+
+	insertUserQuery = `INSERT INTO users(key_id, dek, first_name_enc, last_name_enc, phone_number_enc, phone_number_index, password_hash)
+					   VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id;`
+
+	insertAccountQuery = `INSERT INTO accounts(user_id, balance, account_type, currency)
+						  VALUES($1, $2, $3, $4) RETURNING id;`
+
+	insertCardQuery = `INSERT INTO cards(account_id, key_id, dek, card_number_enc, card_number_index, cvv_hash, expire_time, kind, status)
+					   VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id;`
+
+	cardStatusQuery = `SELECT status, expire_time < CURRENT_DATE FROM cards WHERE card_number_index = $1;`
+
+	cardExistsQuery = `SELECT EXISTS (SELECT 1 FROM cards WHERE card_number_index = $1);`
+
+	// Every attempt counts as a failure until it succeeds; the attempt that
+	// reaches $2 failures locks verification until $3.
+	cardVerificationQuery = `UPDATE cards
+							 SET failed_verifications = CASE WHEN failed_verifications + 1 >= $2 THEN 0 ELSE failed_verifications + 1 END,
+							 verification_locked_until = CASE WHEN failed_verifications + 1 >= $2 THEN $3::TIMESTAMPTZ ELSE NULL END
+							 WHERE card_number_index = $1
+							 AND (verification_locked_until IS NULL OR verification_locked_until <= NOW())
+							 RETURNING cvv_hash, expire_time, status;`
+
+	resetCardVerificationQuery = `UPDATE cards
+								  SET failed_verifications = 0, verification_locked_until = NULL
+								  WHERE card_number_index = $1;`
+
+	cardByIDQuery = `SELECT id, key_id, dek, card_number_enc, expire_time, kind, status, account_id
+					 FROM cards
+					 WHERE id = $1;`
+
+	lockCardQuery = `SELECT id, key_id, dek, card_number_enc, expire_time, kind, status, account_id
+					 FROM cards
+					 WHERE id = $1
+					 FOR UPDATE;`
+
+	updateCardStatusQuery = `UPDATE cards
+							 SET status = $3
+							 WHERE id = $1 AND status = ANY($2)
+							 RETURNING id, key_id, dek, card_number_enc, expire_time, kind, status, account_id;`
+
+	// A card without a CVV hash was issued without a CVV and fails card-present
+	// verification until it is activated.
+	activateCardQuery = `UPDATE cards
+						 SET cvv_hash = $2
+						 WHERE id = $1 AND cvv_hash = ''
+						 RETURNING id;`
+
+	expiringCardsQuery = `SELECT id, key_id, dek, card_number_enc, expire_time, kind, status, account_id
+						  FROM cards
+						  WHERE status = 'active' AND replaced_by IS NULL AND expire_time < $1
+						  ORDER BY expire_time
+						  LIMIT $2;`
+
+	replacedByQuery = `SELECT replaced_by FROM cards WHERE id = $1;`
+
+	reissueCardQuery = `UPDATE cards
+						SET replaced_by = $2
+						WHERE id = $1;`
+
+	insertNotificationQuery = `INSERT INTO notifications(user_id, message)
+							   SELECT user_id, $2 FROM accounts WHERE id = $1;`
+
+	notificationsByUserQuery = `SELECT id, message, created_at
+								FROM notifications
+								WHERE user_id = $1
+								ORDER BY id DESC;`
+
+	replaceCardQuery = `UPDATE cards
+						SET status = 'blocked', replaced_by = $2
+						WHERE id = $1;`
+
+	cardsByAccountQuery = `SELECT id, key_id, dek, card_number_enc, expire_time, kind, status
+						   FROM cards
+						   WHERE account_id = $1
+						   ORDER BY id;`
+
+	getUserByIDQuery = `SELECT id, key_id, dek, first_name_enc, last_name_enc, phone_number_enc, role, created_at
 						FROM users
-	                    JOIN accounts ON users.id = accounts.user_id
+						WHERE id = $1;`
+
+	accountsByUserQuery = `SELECT accounts.id, accounts.user_id, accounts.balance, accounts.balance + accounts.overdraft_limit - held_amount(accounts.id), accounts.overdraft_limit, accounts.currency, accounts.account_type, cards.id, cards.key_id, cards.dek, cards.card_number_enc, cards.expire_time, cards.kind, cards.status
+						   FROM accounts
+						   JOIN cards ON accounts.id = cards.account_id
+						   WHERE accounts.user_id = $1
+						   ORDER BY accounts.id, cards.id;`
+
+	accountByIDQuery = `SELECT accounts.id, accounts.user_id, accounts.balance, accounts.balance + accounts.overdraft_limit - held_amount(accounts.id), accounts.overdraft_limit, accounts.currency, accounts.account_type, cards.id, cards.key_id, cards.dek, cards.card_number_enc, cards.expire_time, cards.kind, cards.status
+						FROM accounts
 						JOIN cards ON accounts.id = cards.account_id
-						WHERE users.id = $1;`
+						WHERE accounts.id = $1 AND accounts.system_name IS NULL
+						ORDER BY cards.id;`
+
+	allAccountsQuery = `SELECT accounts.id, accounts.user_id, accounts.balance, accounts.balance + accounts.overdraft_limit - held_amount(accounts.id), accounts.overdraft_limit, accounts.currency, accounts.account_type, cards.id, cards.key_id, cards.dek, cards.card_number_enc, cards.expire_time, cards.kind, cards.status
+						FROM accounts
+						JOIN cards ON accounts.id = cards.account_id
+						WHERE accounts.user_id IS NOT NULL
+						ORDER BY accounts.id, cards.id;`
+
+	getUserByPhoneNumberQuery = `SELECT id, password_hash, role
+								 FROM users
+								 WHERE phone_number_index = $1;`
+
+	claimIdempotencyKeyQuery = `INSERT INTO idempotency_keys(user_id, idempotency_key, request_hash)
+								VALUES($1, $2, $3)
+								ON CONFLICT (user_id, idempotency_key) DO NOTHING;`
+
+	getIdempotencyKeyQuery = `SELECT request_hash, transaction_id, scheduled_transfer_id
+							  FROM idempotency_keys
+							  WHERE user_id = $1 AND idempotency_key = $2;`
+
+	saveIdempotencyKeyQuery = `UPDATE idempotency_keys
+							   SET transaction_id = $3
+							   WHERE user_id = $1 AND idempotency_key = $2;`
+
+	saveScheduledIdempotencyKeyQuery = `UPDATE idempotency_keys
+										SET scheduled_transfer_id = $3
+										WHERE user_id = $1 AND idempotency_key = $2;`
 
-	getUsersQuery = `SELECT users.id, users.first_name, users.last_name, users.phone_number, users.created_at, accounts.id, accounts.balance, cards.id, cards.card_number, cards.cvv, cards.expire_time
+	getUsersQuery = `SELECT id, key_id, dek, first_name_enc, last_name_enc, phone_number_enc, role, created_at
 					 FROM users
-	                 JOIN accounts ON users.id = accounts.user_id
-				     JOIN cards ON accounts.id = cards.account_id;`
-
-	depositQuery = `UPDATE accounts
-					SET balance = balance + $1
-					WHERE id IN (
-					SELECT accounts.id
-					FROM accounts
-					JOIN users ON accounts.user_id = users.id
-					JOIN cards ON accounts.id = cards.account_id
-					WHERE cards.card_number = $2);`
-
-	insertDepositTransactionQuery = `WITH account AS (
-									 SELECT accounts.id 
-									 FROM accounts
-									 JOIN users ON accounts.user_id = users.id
-									 JOIN cards ON accounts.id = cards.account_id
-									 WHERE cards.card_number = $1
-									 )
-									 INSERT INTO transactions(account_id, transaction_type, amount, to_card_number) 
-									 VALUES((SELECT id from account LIMIT 1), $2, $3, $4) RETURNING transaction_id, created_at;`
+					 ORDER BY id;`
+
+	insertWithdrawalTransactionQuery = `INSERT INTO transactions(transaction_type, amount, from_card_id, currency)
+										VALUES($1, $2, (SELECT id FROM cards WHERE card_number_index = $3), $4) RETURNING transaction_id, created_at;`
+
+	lockTransactionQuery = `SELECT transactions.transaction_id, transactions.transaction_type, transactions.amount, transactions.currency, transactions.converted_amount, transactions.converted_currency, transactions.exchange_rate::TEXT,
+							to_card.key_id, to_card.dek, to_card.card_number_enc, from_card.key_id, from_card.dek, from_card.card_number_enc, transactions.reversal_of, transactions.created_at
+							FROM transactions
+							LEFT JOIN cards AS to_card ON transactions.to_card_id = to_card.id
+							LEFT JOIN cards AS from_card ON transactions.from_card_id = from_card.id
+							WHERE transactions.transaction_id = $1
+							FOR UPDATE OF transactions;`
+
+	reversedAmountQuery = `SELECT COALESCE(SUM(amount), 0)::BIGINT
+						   FROM transactions
+						   WHERE reversal_of = $1;`
+
+	postingsByTransactionQuery = `SELECT account_id, amount
+								  FROM postings
+								  WHERE transaction_id = $1;`
+
+	lockAccountsByIDQuery = `SELECT id, balance + overdraft_limit - held_amount(id), currency, system_name IS NOT NULL
+							 FROM accounts
+							 WHERE id = ANY($1)
+							 ORDER BY id
+							 FOR UPDATE;`
+
+	insertReversalTransactionQuery = `INSERT INTO transactions(transaction_type, amount, to_card_id, from_card_id, reversal_of, currency, converted_amount, converted_currency, exchange_rate)
+									  VALUES($1, $2, (SELECT id FROM cards WHERE card_number_index = $3), (SELECT id FROM cards WHERE card_number_index = $4), $5, $6, $7, $8, $9::NUMERIC)
+									  RETURNING transaction_id, created_at;`
+
+	insertHoldQuery = `INSERT INTO holds(account_id, card_id, merchant_card_id, amount, currency, expires_at)
+					   VALUES($1, (SELECT id FROM cards WHERE card_number_index = $2), (SELECT id FROM cards WHERE card_number_index = $3), $4, $5, $6)
+					   RETURNING id, created_at;`
+
+	holdQuery = `SELECT holds.id, held_card.key_id, held_card.dek, held_card.card_number_enc, merchant_card.key_id, merchant_card.dek, merchant_card.card_number_enc,
+				 holds.amount, holds.captured_amount, holds.currency, holds.status, holds.transaction_id, holds.expires_at, holds.created_at
+				 FROM holds
+				 LEFT JOIN cards AS held_card ON holds.card_id = held_card.id
+				 LEFT JOIN cards AS merchant_card ON holds.merchant_card_id = merchant_card.id
+				 WHERE holds.id = $1;`
+
+	lockHoldQuery = `SELECT holds.id, held_card.key_id, held_card.dek, held_card.card_number_enc, merchant_card.key_id, merchant_card.dek, merchant_card.card_number_enc,
+					 holds.amount, holds.captured_amount, holds.currency, holds.status, holds.transaction_id, holds.expires_at, holds.created_at
+					 FROM holds
+					 LEFT JOIN cards AS held_card ON holds.card_id = held_card.id
+					 LEFT JOIN cards AS merchant_card ON holds.merchant_card_id = merchant_card.id
+					 WHERE holds.id = $1
+					 FOR UPDATE OF holds;`
+
+	captureHoldQuery = `UPDATE holds
+						SET status = 'captured', captured_amount = $2, transaction_id = $3
+						WHERE id = $1;`
+
+	releaseHoldQuery = `UPDATE holds
+						SET status = 'released'
+						WHERE id = $1;`
+
+	expireHoldsQuery = `UPDATE holds
+						SET status = 'expired'
+						WHERE status = 'pending' AND expires_at <= NOW();`
+
+	insertCaptureTransactionQuery = `INSERT INTO transactions(transaction_type, amount, to_card_id, from_card_id, currency)
+									 VALUES($1, $2, (SELECT id FROM cards WHERE card_number_index = $3), (SELECT id FROM cards WHERE card_number_index = $4), $5)
+									 RETURNING transaction_id, created_at;`
+
+	insertScheduledTransferQuery = `INSERT INTO scheduled_transfers(user_id, from_card_id, to_card_id, amount, currency, allow_conversion, execute_at)
+									VALUES($1, (SELECT id FROM cards WHERE card_number_index = $2), (SELECT id FROM cards WHERE card_number_index = $3), $4, $5, $6, $7)
+									RETURNING id, created_at;`
+
+	scheduledTransferQuery = `SELECT scheduled.id, scheduled.user_id, from_card.key_id, from_card.dek, from_card.card_number_enc, to_card.key_id, to_card.dek, to_card.card_number_enc,
+							  scheduled.amount, scheduled.currency, scheduled.allow_conversion, scheduled.execute_at, scheduled.status, scheduled.failure_reason, scheduled.transaction_id, scheduled.executed_at, scheduled.created_at
+							  FROM scheduled_transfers AS scheduled
+							  LEFT JOIN cards AS from_card ON scheduled.from_card_id = from_card.id
+							  LEFT JOIN cards AS to_card ON scheduled.to_card_id = to_card.id
+							  WHERE scheduled.id = $1;`
+
+	cancelScheduledTransferQuery = `WITH scheduled AS (
+									UPDATE scheduled_transfers
+									SET status = 'cancelled'
+									WHERE id = $1 AND status = 'pending'
+									RETURNING *
+									)
+									SELECT scheduled.id, scheduled.user_id, from_card.key_id, from_card.dek, from_card.card_number_enc, to_card.key_id, to_card.dek, to_card.card_number_enc,
+									scheduled.amount, scheduled.currency, scheduled.allow_conversion, scheduled.execute_at, scheduled.status, scheduled.failure_reason, scheduled.transaction_id, scheduled.executed_at, scheduled.created_at
+									FROM scheduled
+									LEFT JOIN cards AS from_card ON scheduled.from_card_id = from_card.id
+									LEFT JOIN cards AS to_card ON scheduled.to_card_id = to_card.id;`
+
+	claimScheduledTransfersQuery = `WITH scheduled AS (
+									UPDATE scheduled_transfers
+									SET status = 'processing', claimed_at = NOW()
+									WHERE id IN (
+									SELECT id FROM scheduled_transfers
+									WHERE execute_at <= NOW() AND (status = 'pending' OR (status = 'processing' AND claimed_at < NOW() - $2::INTERVAL))
+									ORDER BY execute_at
+									LIMIT $1
+									FOR UPDATE SKIP LOCKED
+									)
+									RETURNING *
+									)
+									SELECT scheduled.id, scheduled.user_id, from_card.key_id, from_card.dek, from_card.card_number_enc, to_card.key_id, to_card.dek, to_card.card_number_enc,
+									scheduled.amount, scheduled.currency, scheduled.allow_conversion, scheduled.execute_at, scheduled.status, scheduled.failure_reason, scheduled.transaction_id, scheduled.executed_at, scheduled.created_at
+									FROM scheduled
+									LEFT JOIN cards AS from_card ON scheduled.from_card_id = from_card.id
+									LEFT JOIN cards AS to_card ON scheduled.to_card_id = to_card.id
+									ORDER BY scheduled.execute_at;`
+
+	finishScheduledTransferQuery = `UPDATE scheduled_transfers
+									SET status = $2, failure_reason = $3, transaction_id = $4, executed_at = NOW()
+									WHERE id = $1;`
+
+	insertStandingOrderQuery = `INSERT INTO standing_orders(user_id, from_card_id, to_card_id, amount, currency, allow_conversion, frequency, start_at, end_at, next_run_at, max_retries)
+								VALUES($1, (SELECT id FROM cards WHERE card_number_index = $2), (SELECT id FROM cards WHERE card_number_index = $3), $4, $5, $6, $7, $8, $9, $10, $11)
+								RETURNING id, created_at;`
+
+	standingOrderQuery = `SELECT orders.id, orders.user_id, from_card.key_id, from_card.dek, from_card.card_number_enc, to_card.key_id, to_card.dek, to_card.card_number_enc,
+						  orders.amount, orders.currency, orders.allow_conversion, orders.frequency, orders.start_at, orders.end_at, orders.next_run_at, orders.period, orders.attempts, orders.max_retries, orders.status, orders.created_at
+						  FROM standing_orders AS orders
+						  LEFT JOIN cards AS from_card ON orders.from_card_id = from_card.id
+						  LEFT JOIN cards AS to_card ON orders.to_card_id = to_card.id
+						  WHERE orders.id = $1;`
+
+	standingOrdersByUserQuery = `SELECT orders.id, orders.user_id, from_card.key_id, from_card.dek, from_card.card_number_enc, to_card.key_id, to_card.dek, to_card.card_number_enc,
+								 orders.amount, orders.currency, orders.allow_conversion, orders.frequency, orders.start_at, orders.end_at, orders.next_run_at, orders.period, orders.attempts, orders.max_retries, orders.status, orders.created_at
+								 FROM standing_orders AS orders
+								 LEFT JOIN cards AS from_card ON orders.from_card_id = from_card.id
+								 LEFT JOIN cards AS to_card ON orders.to_card_id = to_card.id
+								 WHERE orders.user_id = $1
+								 ORDER BY orders.created_at DESC;`
+
+	updateStandingOrderQuery = `WITH orders AS (
+								UPDATE standing_orders
+								SET amount = COALESCE($2, amount), end_at = COALESCE($3, end_at)
+								WHERE id = $1 AND status = 'active'
+								RETURNING *
+								)
+								SELECT orders.id, orders.user_id, from_card.key_id, from_card.dek, from_card.card_number_enc, to_card.key_id, to_card.dek, to_card.card_number_enc,
+								orders.amount, orders.currency, orders.allow_conversion, orders.frequency, orders.start_at, orders.end_at, orders.next_run_at, orders.period, orders.attempts, orders.max_retries, orders.status, orders.created_at
+								FROM orders
+								LEFT JOIN cards AS from_card ON orders.from_card_id = from_card.id
+								LEFT JOIN cards AS to_card ON orders.to_card_id = to_card.id;`
+
+	cancelStandingOrderQuery = `WITH orders AS (
+								UPDATE standing_orders
+								SET status = 'cancelled'
+								WHERE id = $1 AND status = 'active'
+								RETURNING *
+								)
+								SELECT orders.id, orders.user_id, from_card.key_id, from_card.dek, from_card.card_number_enc, to_card.key_id, to_card.dek, to_card.card_number_enc,
+								orders.amount, orders.currency, orders.allow_conversion, orders.frequency, orders.start_at, orders.end_at, orders.next_run_at, orders.period, orders.attempts, orders.max_retries, orders.status, orders.created_at
+								FROM orders
+								LEFT JOIN cards AS from_card ON orders.from_card_id = from_card.id
+								LEFT JOIN cards AS to_card ON orders.to_card_id = to_card.id;`
+
+	claimStandingOrdersQuery = `WITH orders AS (
+								UPDATE standing_orders
+								SET claimed_at = NOW()
+								WHERE id IN (
+								SELECT id FROM standing_orders
+								WHERE status = 'active' AND next_run_at <= NOW() AND (claimed_at IS NULL OR claimed_at < NOW() - $2::INTERVAL)
+								ORDER BY next_run_at
+								LIMIT $1
+								FOR UPDATE SKIP LOCKED
+								)
+								RETURNING *
+								)
+								SELECT orders.id, orders.user_id, from_card.key_id, from_card.dek, from_card.card_number_enc, to_card.key_id, to_card.dek, to_card.card_number_enc,
+								orders.amount, orders.currency, orders.allow_conversion, orders.frequency, orders.start_at, orders.end_at, orders.next_run_at, orders.period, orders.attempts, orders.max_retries, orders.status, orders.created_at
+								FROM orders
+								LEFT JOIN cards AS from_card ON orders.from_card_id = from_card.id
+								LEFT JOIN cards AS to_card ON orders.to_card_id = to_card.id
+								ORDER BY orders.next_run_at;`
+
+	insertStandingOrderRunQuery = `INSERT INTO standing_order_runs(standing_order_id, scheduled_for, attempt, status, failure_reason, transaction_id)
+								   VALUES($1, $2, $3, $4, $5, $6);`
+
+	advanceStandingOrderQuery = `UPDATE standing_orders
+								 SET period = $2, attempts = $3, next_run_at = $4, status = CASE WHEN status = 'cancelled' THEN status ELSE $5 END, claimed_at = NULL
+								 WHERE id = $1;`
+
+	standingOrderRunsQuery = `SELECT id, standing_order_id, scheduled_for, attempt, status, failure_reason, transaction_id, created_at
+							  FROM standing_order_runs
+							  WHERE standing_order_id = $1
+							  ORDER BY id DESC;`
+
+	accountLimitsQuery = `SELECT transaction_limit, daily_limit, daily_count_limit, currency
+						  FROM accounts
+						  WHERE id = $1 AND system_name IS NULL;`
+
+	updateAccountLimitsQuery = `UPDATE accounts
+								SET transaction_limit = $2, daily_limit = $3, daily_count_limit = $4
+								WHERE id = $1 AND system_name IS NULL
+								RETURNING transaction_limit, daily_limit, daily_count_limit, currency;`
+
+	setOverdraftQuery = `UPDATE accounts
+						 SET overdraft_limit = $2
+						 WHERE id = $1 AND system_name IS NULL
+						 RETURNING overdraft_limit, currency;`
+
+	accountBalanceQuery = `SELECT balance FROM accounts WHERE id = $1;`
+
+	dailyOutgoingQuery = `SELECT COALESCE(SUM(-amount), 0)::BIGINT, COUNT(DISTINCT transaction_id)
+						  FROM postings
+						  WHERE account_id = $1
+						  AND amount < 0
+						  AND created_at >= date_trunc('day', NOW());`
+
+	interestLockQuery = `SELECT pg_advisory_xact_lock(hashtext('interest'));`
+
+	// Accrues every day after accrued_through up to $1 on the ledger balance
+	// at the end of that day (UTC). Overdrawn balances earn nothing.
+	accrueInterestQuery = `INSERT INTO interest_accruals(account_id, accrual_date, balance, annual_rate_bps, amount)
+						   SELECT accounts.id, day::DATE, eod.balance, interest_rates.annual_rate_bps,
+						   GREATEST(eod.balance, 0) * interest_rates.annual_rate_bps / 10000.0 / 365
+						   FROM accounts
+						   JOIN interest_rates ON accounts.account_type = interest_rates.account_type
+						   CROSS JOIN LATERAL generate_series((accounts.accrued_through + 1)::TIMESTAMP, $1::DATE::TIMESTAMP, INTERVAL '1 day') AS day
+						   CROSS JOIN LATERAL (
+						   SELECT COALESCE(SUM(postings.amount), 0)::BIGINT AS balance
+						   FROM postings
+						   WHERE postings.account_id = accounts.id AND postings.created_at < (day + INTERVAL '1 day') AT TIME ZONE 'UTC'
+						   ) AS eod
+						   WHERE accounts.system_name IS NULL AND interest_rates.annual_rate_bps > 0
+						   ON CONFLICT (account_id, accrual_date) DO NOTHING;`
+
+	advanceAccrualQuery = `UPDATE accounts
+						   SET accrued_through = $1
+						   WHERE system_name IS NULL AND accrued_through < $1;`
+
+	uncapitalizedInterestQuery = `SELECT interest_accruals.account_id, ROUND(SUM(amount))::BIGINT, accounts.currency, card.id
+								  FROM interest_accruals
+								  JOIN accounts ON interest_accruals.account_id = accounts.id
+								  CROSS JOIN LATERAL (
+								  SELECT id FROM cards WHERE cards.account_id = interest_accruals.account_id ORDER BY cards.status = 'active' DESC, cards.id LIMIT 1
+								  ) AS card
+								  WHERE transaction_id IS NULL AND accrual_date < $1
+								  GROUP BY interest_accruals.account_id, accounts.currency, card.id
+								  HAVING ROUND(SUM(amount)) > 0;`
+
+	insertInterestTransactionQuery = `INSERT INTO transactions(transaction_type, amount, to_card_id, currency)
+									  VALUES($1, $2, $3, $4) RETURNING transaction_id, created_at;`
+
+	capitalizeAccrualsQuery = `UPDATE interest_accruals
+							   SET transaction_id = $2
+							   WHERE account_id = $1 AND transaction_id IS NULL AND accrual_date < $3;`
+
+	interestRatesQuery = `SELECT account_type, annual_rate_bps FROM interest_rates ORDER BY account_type;`
+
+	setInterestRateQuery = `UPDATE interest_rates
+							SET annual_rate_bps = $2
+							WHERE account_type = $1
+							RETURNING account_type, annual_rate_bps;`
+
+	plaintextUsersQuery = `SELECT id, first_name, last_name, phone_number
+						   FROM users
+						   WHERE key_id IS NULL
+						   LIMIT $1;`
+
+	sealUserQuery = `UPDATE users
+					 SET key_id = $2, dek = $3, first_name_enc = $4, last_name_enc = $5, phone_number_enc = $6, phone_number_index = $7,
+					 first_name = NULL, last_name = NULL, phone_number = NULL
+					 WHERE id = $1 AND key_id IS NULL;`
+
+	plaintextCardsQuery = `SELECT id, card_number
+						   FROM cards
+						   WHERE key_id IS NULL
+						   LIMIT $1;`
+
+	sealCardQuery = `UPDATE cards
+					 SET key_id = $2, dek = $3, card_number_enc = $4, card_number_index = $5, card_number = NULL
+					 WHERE id = $1 AND key_id IS NULL;`
+
+	staleUserKeysQuery = `SELECT id, key_id, dek FROM users WHERE key_id <> $1 LIMIT $2;`
+
+	rewrapUserQuery = `UPDATE users SET key_id = $3, dek = $4 WHERE id = $1 AND key_id = $2;`
+
+	staleCardKeysQuery = `SELECT id, key_id, dek FROM cards WHERE key_id <> $1 LIMIT $2;`
+
+	rewrapCardQuery = `UPDATE cards SET key_id = $3, dek = $4 WHERE id = $1 AND key_id = $2;`
+
+	// Rows written before cards were referenced by id still hold card numbers;
+	// an empty number stands for no card.
+	plaintextTransactionCardsQuery = `SELECT transaction_id, to_card_number, from_card_number
+									  FROM transactions
+									  WHERE to_card_number IS NOT NULL OR from_card_number IS NOT NULL
+									  LIMIT $1;`
+
+	referenceTransactionCardsQuery = `UPDATE transactions
+									  SET to_card_id = (SELECT id FROM cards WHERE card_number_index = $2), from_card_id = (SELECT id FROM cards WHERE card_number_index = $3),
+									  to_card_number = NULL, from_card_number = NULL
+									  WHERE transaction_id = $1;`
+
+	plaintextHoldCardsQuery = `SELECT id, card_number, merchant_card_number
+							   FROM holds
+							   WHERE card_number IS NOT NULL OR merchant_card_number IS NOT NULL
+							   LIMIT $1;`
+
+	referenceHoldCardsQuery = `UPDATE holds
+							   SET card_id = (SELECT id FROM cards WHERE card_number_index = $2), merchant_card_id = (SELECT id FROM cards WHERE card_number_index = $3),
+							   card_number = NULL, merchant_card_number = NULL
+							   WHERE id = $1;`
+
+	plaintextScheduledTransferCardsQuery = `SELECT id, from_card_number, to_card_number
+											FROM scheduled_transfers
+											WHERE from_card_number IS NOT NULL OR to_card_number IS NOT NULL
+											LIMIT $1;`
+
+	referenceScheduledTransferCardsQuery = `UPDATE scheduled_transfers
+											SET from_card_id = (SELECT id FROM cards WHERE card_number_index = $2), to_card_id = (SELECT id FROM cards WHERE card_number_index = $3),
+											from_card_number = NULL, to_card_number = NULL
+											WHERE id = $1;`
+
+	plaintextStandingOrderCardsQuery = `SELECT id, from_card_number, to_card_number
+										FROM standing_orders
+										WHERE from_card_number IS NOT NULL OR to_card_number IS NOT NULL
+										LIMIT $1;`
+
+	referenceStandingOrderCardsQuery = `UPDATE standing_orders
+										SET from_card_id = (SELECT id FROM cards WHERE card_number_index = $2), to_card_id = (SELECT id FROM cards WHERE card_number_index = $3),
+										from_card_number = NULL, to_card_number = NULL
+										WHERE id = $1;`
+
+	insertCardTokenQuery = `INSERT INTO card_tokens(token, card_id)
+							VALUES($1, $2)
+							ON CONFLICT DO NOTHING;`
+
+	cardTokenByCardQuery = `SELECT token, card_id, created_at FROM card_tokens WHERE card_id = $1;`
+
+	cardByTokenQuery = `SELECT cards.id, cards.key_id, cards.dek, cards.card_number_enc, cards.expire_time, cards.kind, cards.status, cards.account_id
+						FROM card_tokens
+						JOIN cards ON card_tokens.card_id = cards.id
+						WHERE card_tokens.token = $1;`
+
+	insertDetokenizationQuery = `INSERT INTO detokenization_log(token, user_id, reason)
+								 VALUES($1, $2, $3);`
+
+	detokenizationsQuery = `SELECT id, token, user_id, reason, created_at
+							FROM detokenization_log
+							ORDER BY id DESC;`
+
+	insertDepositTransactionQuery = `INSERT INTO transactions(transaction_type, amount, to_card_id, currency)
+									 VALUES($1, $2, (SELECT id FROM cards WHERE card_number_index = $3), $4) RETURNING transaction_id, created_at;`
 )
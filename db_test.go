@@ -4,18 +4,20 @@ import (
 	"context"
 	"os"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/brianvoe/gofakeit"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 const (
-	minAmount = 0.01
-	maxAmount = 1000.00
+	minAmount Money = 1
+	maxAmount Money = 100000
 )
 
 type Suite struct {
@@ -33,18 +35,24 @@ func NewSuite(t *testing.T) (context.Context, *Suite) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 
-	t.Cleanup(func() {
-		t.Helper()
-		cancel()
-	})
-
 	connStr := os.Getenv("DATABASE_URL")
 
-	store, err := NewStorage(ctx, connStr)
+	keys, err := ParseKeyring(os.Getenv("PII_KEYS"), os.Getenv("PII_ACTIVE_KEY"), os.Getenv("PII_INDEX_KEY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewStorage(ctx, connStr, PoolConfig{MaxConns: 10}, os.Getenv("CVV_SECRET"), keys)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	t.Cleanup(func() {
+		t.Helper()
+		store.Close()
+		cancel()
+	})
+
 	return ctx, &Suite{
 		T:     t,
 		store: store,
@@ -84,32 +92,18 @@ func TestRegister_Duplicate(t *testing.T) {
 				LastName:     gofakeit.LastName(),
 				PhoneNumber:  user.PhoneNumber,
 				PasswordHash: randomFakePassword(),
-				Account: Account{
-					Balance: user.Account.Balance,
-					Card: Card{
+				Accounts: []Account{{
+					Balance:  user.Accounts[0].Balance,
+					Currency: defaultCurrency,
+					Type:     checkingAccount,
+					Cards: []Card{{
 						Number:     strconv.Itoa(card.Number),
 						CVV:        card.Cvv,
-						ExpireTime: card.Exp,
-					},
-				},
-			},
-			expectedErr: UserExists().Error(),
-		},
-		{
-			name: "Duplicate CardNumber",
-			user: User{
-				FirstName:    gofakeit.FirstName(),
-				LastName:     gofakeit.LastName(),
-				PhoneNumber:  gofakeit.Phone(),
-				PasswordHash: randomFakePassword(),
-				Account: Account{
-					Balance: user.Account.Balance,
-					Card: Card{
-						Number:     user.Account.Card.Number,
-						CVV:        card.Cvv,
-						ExpireTime: card.Exp,
-					},
-				},
+						ExpireTime: time.Now().AddDate(1, 0, 0),
+						Kind:       cardPhysical,
+						Status:     cardActive,
+					}},
+				}},
 			},
 			expectedErr: UserExists().Error(),
 		},
@@ -120,14 +114,18 @@ func TestRegister_Duplicate(t *testing.T) {
 				LastName:     gofakeit.LastName(),
 				PhoneNumber:  user.PhoneNumber,
 				PasswordHash: randomFakePassword(),
-				Account: Account{
-					Balance: user.Account.Balance,
-					Card: Card{
-						Number:     user.Account.Card.Number,
+				Accounts: []Account{{
+					Balance:  user.Accounts[0].Balance,
+					Currency: defaultCurrency,
+					Type:     checkingAccount,
+					Cards: []Card{{
+						Number:     user.Accounts[0].Cards[0].Number,
 						CVV:        card.Cvv,
-						ExpireTime: card.Exp,
-					},
-				},
+						ExpireTime: time.Now().AddDate(1, 0, 0),
+						Kind:       cardPhysical,
+						Status:     cardActive,
+					}},
+				}},
 			},
 			expectedErr: UserExists().Error(),
 		},
@@ -141,6 +139,16 @@ func TestRegister_Duplicate(t *testing.T) {
 			assert.ErrorContains(t, err, tt.expectedErr)
 		})
 	}
+
+	// A colliding card number is replaced instead of failing registration.
+	collision := fakeUser()
+	collision.Accounts[0].Cards[0].Number = user.Accounts[0].Cards[0].Number
+
+	id, err = st.store.Register(ctx, collision)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+	assert.NotEqual(t, user.Accounts[0].Cards[0].Number, collision.Accounts[0].Cards[0].Number)
+	assert.True(t, luhnValid(collision.Accounts[0].Cards[0].Number))
 }
 
 func TestDeposit(t *testing.T) {
@@ -154,8 +162,8 @@ func TestDeposit(t *testing.T) {
 
 	deposit := TransactionRequest{
 		Type:         depositTransaction,
-		ToCardNumber: user.Account.Card.Number,
-		Amount:       gofakeit.Price(minAmount, maxAmount),
+		ToCardNumber: user.Accounts[0].Cards[0].Number,
+		Amount:       fakeAmount(),
 	}
 
 	assert.GreaterOrEqual(t, deposit.Amount, minAmount)
@@ -169,20 +177,88 @@ func TestDeposit(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotEmpty(t, u)
 
-	assert.Equal(t, deposit.Amount, u.Account.Balance)
+	assert.Equal(t, deposit.Amount, u.Accounts[0].Balance)
 
 	card := gofakeit.CreditCard()
 
 	deposit = TransactionRequest{
 		Type:         depositTransaction,
 		ToCardNumber: strconv.Itoa(card.Number),
-		Amount:       gofakeit.Price(minAmount, maxAmount),
+		Amount:       fakeAmount(),
 	}
 
 	tr, err = st.store.Deposit(ctx, &deposit)
 	require.Error(t, err)
 	assert.Empty(t, tr)
 	assert.ErrorContains(t, err, NoAccount(strconv.Itoa(card.Number)).Error())
+	assert.NotContains(t, err.Error(), strconv.Itoa(card.Number))
+
+	// A card issued before numbers carried a check digit still works.
+	legacy := fakeUser()
+	legacy.Accounts[0].Cards[0].Number = wrongCheckDigit(legacy.Accounts[0].Cards[0].Number)
+
+	_, err = st.store.Register(ctx, legacy)
+	require.NoError(t, err)
+
+	deposit.ToCardNumber = legacy.Accounts[0].Cards[0].Number
+
+	tr, err = st.store.Deposit(ctx, &deposit)
+	require.NoError(t, err)
+	assert.Equal(t, deposit.Amount, tr.Amount)
+
+	// Only numbers of issued cards are exempt from the check digit.
+	unknown := wrongCheckDigit(strconv.Itoa(card.Number))
+
+	deposit.ToCardNumber = legacy.Accounts[0].Cards[0].Number
+	errs := deposit.ValidateTransaction()
+	require.Equal(t, invalidCheckDigit, errs["toCardNumber"])
+
+	srv := NewServer("", st.store, nil)
+	require.NoError(t, srv.allowLegacyCardNumbers(ctx, errs, map[string]string{"toCardNumber": deposit.ToCardNumber}))
+	assert.Empty(t, errs)
+
+	deposit.ToCardNumber = unknown
+	errs = deposit.ValidateTransaction()
+	require.NoError(t, srv.allowLegacyCardNumbers(ctx, errs, map[string]string{"toCardNumber": deposit.ToCardNumber}))
+	assert.Equal(t, invalidCheckDigit, errs["toCardNumber"])
+}
+
+func TestDeposit_Idempotent(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user := fakeUser()
+
+	id, err := st.store.Register(ctx, user)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	deposit := TransactionRequest{
+		Type:           depositTransaction,
+		ToCardNumber:   user.Accounts[0].Cards[0].Number,
+		Amount:         fakeAmount(),
+		UserID:         id,
+		IdempotencyKey: gofakeit.UUID(),
+	}
+
+	tr1, err := st.store.Deposit(ctx, &deposit)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tr1)
+
+	tr2, err := st.store.Deposit(ctx, &deposit)
+	require.NoError(t, err)
+	assert.Equal(t, tr1.ID, tr2.ID)
+	assert.Equal(t, tr1.Amount, tr2.Amount)
+
+	u, err := st.store.UserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, deposit.Amount, u.Accounts[0].Balance)
+
+	deposit.Amount++
+
+	tr3, err := st.store.Deposit(ctx, &deposit)
+	require.Error(t, err)
+	assert.Empty(t, tr3)
+	assert.ErrorContains(t, err, IdempotencyKeyReused().Error())
 }
 
 func TestTransfer(t *testing.T) {
@@ -205,8 +281,8 @@ func TestTransfer(t *testing.T) {
 
 	deposit := TransactionRequest{
 		Type:         depositTransaction,
-		ToCardNumber: u1.Account.Card.Number,
-		Amount:       gofakeit.Price(minAmount, maxAmount),
+		ToCardNumber: u1.Accounts[0].Cards[0].Number,
+		Amount:       fakeAmount(),
 	}
 
 	depositToUser1, err := st.store.Deposit(ctx, &deposit)
@@ -223,9 +299,9 @@ func TestTransfer(t *testing.T) {
 
 	transfer := TransactionRequest{
 		Type:           transferTransaction,
-		FromCardNumber: u1.Account.Card.Number,
-		ToCardNumber:   u2.Account.Card.Number,
-		Amount:         u1.Account.Balance,
+		FromCardNumber: u1.Accounts[0].Cards[0].Number,
+		ToCardNumber:   u2.Accounts[0].Cards[0].Number,
+		Amount:         u1.Accounts[0].Balance,
 	}
 
 	tr, err := st.store.Transfer(ctx, &transfer)
@@ -240,10 +316,83 @@ func TestTransfer(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotEmpty(t, u2)
 
-	assert.Empty(t, u1.Account.Balance)
-	assert.Equal(t, u1.Account.Balance+transfer.Amount, u2.Account.Balance)
-	assert.Equal(t, tr.FromCardNumber, u1.Account.Card.Number)
-	assert.Equal(t, tr.ToCardNumber, u2.Account.Card.Number)
+	assert.Empty(t, u1.Accounts[0].Balance)
+	assert.Equal(t, u1.Accounts[0].Balance+transfer.Amount, u2.Accounts[0].Balance)
+	assert.Equal(t, tr.FromCardNumber, u1.Accounts[0].Cards[0].Number)
+	assert.Equal(t, tr.ToCardNumber, u2.Accounts[0].Cards[0].Number)
+}
+
+func TestTransfer_Concurrent(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user1 := fakeUser()
+	user2 := fakeUser()
+
+	id1, err := st.store.Register(ctx, user1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id1)
+
+	id2, err := st.store.Register(ctx, user2)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id2)
+
+	const (
+		transfers       = 20
+		amount    Money = 100
+	)
+
+	deposit := TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       amount * transfers / 2,
+	}
+
+	tr, err := st.store.Deposit(ctx, &deposit)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tr)
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, transfers)
+	)
+
+	for i := 0; i < transfers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := st.store.Transfer(ctx, &TransactionRequest{
+				Type:           transferTransaction,
+				FromCardNumber: user1.Accounts[0].Cards[0].Number,
+				ToCardNumber:   user2.Accounts[0].Cards[0].Number,
+				Amount:         amount,
+			})
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	var succeeded, insufficient int
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		require.ErrorContains(t, err, "insufficient funds")
+		insufficient++
+	}
+
+	assert.Equal(t, transfers/2, succeeded)
+	assert.Equal(t, transfers/2, insufficient)
+
+	u1, err := st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	assert.Empty(t, u1.Accounts[0].Balance)
+
+	u2, err := st.store.UserByID(ctx, id2)
+	require.NoError(t, err)
+	assert.Equal(t, deposit.Amount, u2.Accounts[0].Balance)
 }
 
 func TestTransfer_Fail(t *testing.T) {
@@ -262,8 +411,8 @@ func TestTransfer_Fail(t *testing.T) {
 
 	deposit := TransactionRequest{
 		Type:         depositTransaction,
-		ToCardNumber: user1.Account.Card.Number,
-		Amount:       gofakeit.Price(minAmount, maxAmount),
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       fakeAmount(),
 	}
 
 	tr, err := st.store.Deposit(ctx, &deposit)
@@ -290,8 +439,8 @@ func TestTransfer_Fail(t *testing.T) {
 			transfer: TransactionRequest{
 				Type:           transferTransaction,
 				ToCardNumber:   strconv.Itoa(card.Number),
-				FromCardNumber: u1.Account.Card.Number,
-				Amount:         u1.Account.Balance,
+				FromCardNumber: u1.Accounts[0].Cards[0].Number,
+				Amount:         u1.Accounts[0].Balance,
 			},
 			expectedErr: NoAccount(strconv.Itoa(card.Number)).Error(),
 		},
@@ -299,9 +448,9 @@ func TestTransfer_Fail(t *testing.T) {
 			name: "FromCardNumber account doesn't exist",
 			transfer: TransactionRequest{
 				Type:           transferTransaction,
-				ToCardNumber:   u1.Account.Card.Number,
+				ToCardNumber:   u1.Accounts[0].Cards[0].Number,
 				FromCardNumber: strconv.Itoa(card.Number),
-				Amount:         u1.Account.Balance,
+				Amount:         u1.Accounts[0].Balance,
 			},
 			expectedErr: NoAccount(strconv.Itoa(card.Number)).Error(),
 		},
@@ -309,11 +458,11 @@ func TestTransfer_Fail(t *testing.T) {
 			name: "Insufficient Funds",
 			transfer: TransactionRequest{
 				Type:           transferTransaction,
-				ToCardNumber:   u2.Account.Card.Number,
-				FromCardNumber: u1.Account.Card.Number,
-				Amount:         u1.Account.Balance * 2,
+				ToCardNumber:   u2.Accounts[0].Cards[0].Number,
+				FromCardNumber: u1.Accounts[0].Cards[0].Number,
+				Amount:         u1.Accounts[0].Balance * 2,
 			},
-			expectedErr: InsufficientFunds(u1.Account.Balance, u1.Account.Balance*2).Error(),
+			expectedErr: InsufficientFunds(u1.Accounts[0].Balance, u1.Accounts[0].Balance*2, defaultCurrency).Error(),
 		},
 	}
 
@@ -323,97 +472,159 @@ func TestTransfer_Fail(t *testing.T) {
 			require.Error(t, err)
 			assert.Empty(t, tr)
 			assert.ErrorContains(t, err, tt.expectedErr)
+			assert.NotContains(t, err.Error(), strconv.Itoa(card.Number))
 		})
 	}
 }
 
-func TestUserByID(t *testing.T) {
+func TestTransfer_Limits(t *testing.T) {
 	ctx, st := NewSuite(t)
 
-	newUser := fakeUser()
+	user1 := fakeUser()
+	user2 := fakeUser()
 
-	id, err := st.store.Register(ctx, newUser)
+	id1, err := st.store.Register(ctx, user1)
 	require.NoError(t, err)
-	assert.NotEmpty(t, id)
+	assert.NotEmpty(t, id1)
 
-	user, err := st.store.UserByID(ctx, id)
+	_, err = st.store.Register(ctx, user2)
 	require.NoError(t, err)
-	assert.NotEmpty(t, user)
 
-	fakeId := gofakeit.Uint8()
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       10000,
+	})
+	require.NoError(t, err)
 
-	fakeUser, err := st.store.UserByID(ctx, int(fakeId))
+	limits, err := st.store.UpdateLimits(ctx, user1.Accounts[0].ID, &AccountLimits{
+		TransactionLimit: 1000,
+		DailyLimit:       1500,
+		DailyCountLimit:  2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Money(1000), limits.TransactionLimit)
+
+	stored, err := st.store.LimitsByAccount(ctx, user1.Accounts[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, limits, stored)
+
+	transfer := func(amount Money) error {
+		_, err := st.store.Transfer(ctx, &TransactionRequest{
+			Type:           transferTransaction,
+			FromCardNumber: user1.Accounts[0].Cards[0].Number,
+			ToCardNumber:   user2.Accounts[0].Cards[0].Number,
+			Amount:         amount,
+		})
+		return err
+	}
+
+	err = transfer(1001)
 	require.Error(t, err)
-	assert.Empty(t, fakeUser)
-	assert.ErrorContains(t, err, NoUser().Error())
-}
+	assert.ErrorContains(t, err, LimitExceeded("transaction", "10.00", "10.01").Error())
 
-func TestTransactionsByUser(t *testing.T) {
-	ctx, st := NewSuite(t)
+	require.NoError(t, transfer(1000))
 
-	newUser1 := fakeUser()
-	newUser2 := fakeUser()
+	err = transfer(600)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, LimitExceeded("daily amount", "15.00", "16.00").Error())
 
-	id1, err := st.store.Register(ctx, newUser1)
+	require.NoError(t, transfer(100))
+
+	err = transfer(100)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, LimitExceeded("daily count", "2", "3").Error())
+
+	// Withdrawals count toward the same daily limits as transfers.
+	_, err = st.store.Withdraw(ctx, &TransactionRequest{
+		Type:           withdrawalTransaction,
+		FromCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:         100,
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, LimitExceeded("daily count", "2", "3").Error())
+
+	u1, err := st.store.UserByID(ctx, id1)
 	require.NoError(t, err)
-	assert.NotEmpty(t, id1)
+	assert.Equal(t, Money(8900), u1.Accounts[0].Balance)
 
-	id2, err := st.store.Register(ctx, newUser2)
+	_, err = st.store.LimitsByAccount(ctx, -1)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, NoAccountID(-1).Error())
+}
+
+func TestTransfer_Overdraft(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user1 := fakeUser()
+	user2 := fakeUser()
+
+	id1, err := st.store.Register(ctx, user1)
 	require.NoError(t, err)
 	assert.NotEmpty(t, id1)
 
-	user1, err := st.store.UserByID(ctx, id1)
+	_, err = st.store.Register(ctx, user2)
 	require.NoError(t, err)
-	assert.NotEmpty(t, user1)
 
-	user2, err := st.store.UserByID(ctx, id2)
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       1000,
+	})
 	require.NoError(t, err)
-	assert.NotEmpty(t, user2)
 
-	deposit := TransactionRequest{
-		Type:         depositTransaction,
-		ToCardNumber: user1.Account.Card.Number,
-		Amount:       gofakeit.Price(minAmount, maxAmount),
+	transfer := func(amount Money) error {
+		_, err := st.store.Transfer(ctx, &TransactionRequest{
+			Type:           transferTransaction,
+			FromCardNumber: user1.Accounts[0].Cards[0].Number,
+			ToCardNumber:   user2.Accounts[0].Cards[0].Number,
+			Amount:         amount,
+		})
+		return err
 	}
 
-	tr, err := st.store.Deposit(ctx, &deposit)
+	err = transfer(1500)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, InsufficientFunds(1000, 1500, defaultCurrency).Error())
+
+	account, err := st.store.SetOverdraft(ctx, user1.Accounts[0].ID, 1000)
 	require.NoError(t, err)
-	assert.NotEmpty(t, tr)
+	assert.Equal(t, Money(1000), account.OverdraftLimit)
+	assert.Equal(t, defaultCurrency, account.Currency)
 
-	deposit = TransactionRequest{
-		Type:         depositTransaction,
-		ToCardNumber: user1.Account.Card.Number,
-		Amount:       gofakeit.Price(minAmount, maxAmount),
-	}
+	require.NoError(t, transfer(1500))
 
-	tr, err = st.store.Deposit(ctx, &deposit)
+	u1, err := st.store.UserByID(ctx, id1)
 	require.NoError(t, err)
-	assert.NotEmpty(t, tr)
+	assert.Equal(t, Money(-500), u1.Accounts[0].Balance)
+	assert.Equal(t, Money(500), u1.Accounts[0].AvailableBalance)
+	assert.Equal(t, Money(1000), u1.Accounts[0].OverdraftLimit)
 
-	transfer := TransactionRequest{
-		Type:           transferTransaction,
-		FromCardNumber: user1.Account.Card.Number,
-		ToCardNumber:   user2.Account.Card.Number,
-		Amount:         1,
-	}
+	err = transfer(600)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, InsufficientFunds(500, 600, defaultCurrency).Error())
 
-	tr, err = st.store.Transfer(ctx, &transfer)
-	require.NoError(t, err)
-	assert.NotEmpty(t, tr)
+	_, err = st.store.SetOverdraft(ctx, user1.Accounts[0].ID, 0)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, OverdraftInUse(-500).Error())
 
-	trs, err := st.store.TransactionsByUser(ctx, user1.ID)
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       500,
+	})
 	require.NoError(t, err)
-	assert.Len(t, trs, 3)
 
-	fakeId := gofakeit.Uint8()
+	account, err = st.store.SetOverdraft(ctx, user1.Accounts[0].ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, Money(0), account.OverdraftLimit)
 
-	trs, err = st.store.TransactionsByUser(ctx, int(fakeId))
+	_, err = st.store.SetOverdraft(ctx, -1, 1000)
 	require.Error(t, err)
-	assert.Empty(t, trs)
-	assert.ErrorContains(t, err, NoUser().Error())
+	assert.ErrorContains(t, err, NoAccountID(-1).Error())
 }
 
-func TestInsertDepositTransaction(t *testing.T) {
+func TestDeposit_Concurrent(t *testing.T) {
 	ctx, st := NewSuite(t)
 
 	user := fakeUser()
@@ -422,75 +633,1575 @@ func TestInsertDepositTransaction(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotEmpty(t, id)
 
-	deposit := TransactionRequest{
-		Type:         depositTransaction,
-		ToCardNumber: user.Account.Card.Number,
-		Amount:       gofakeit.Price(minAmount, maxAmount),
+	const deposits = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, deposits)
+
+	for i := 0; i < deposits; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := st.store.Deposit(ctx, &TransactionRequest{
+				Type:         depositTransaction,
+				ToCardNumber: user.Accounts[0].Cards[0].Number,
+				Amount:       100,
+			})
+			errs <- err
+		}()
 	}
 
-	tr, err := st.store.Deposit(ctx, &deposit)
-	require.NoError(t, err)
-	assert.NotEmpty(t, tr)
+	wg.Wait()
+	close(errs)
 
-	now := time.Now().UTC()
-	delta := time.Second
+	for err := range errs {
+		require.NoError(t, err)
+	}
 
-	assert.NotEmpty(t, tr.ID)
-	assert.Empty(t, tr.FromCardNumber)
-	assert.Equal(t, deposit.Amount, tr.Amount)
-	assert.Greater(t, tr.Amount, 0.00)
-	assert.Equal(t, user.Account.Card.Number, tr.ToCardNumber)
-	assert.WithinDuration(t, now, tr.CreatedAt, delta)
+	u, err := st.store.UserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, Money(deposits*100), u.Accounts[0].Balance)
 }
 
-func TestInsertTransferTransaction(t *testing.T) {
+func TestLedger_Balanced(t *testing.T) {
 	ctx, st := NewSuite(t)
 
-	newUser1 := fakeUser()
-	newUser2 := fakeUser()
+	user1 := fakeUser()
+	user2 := fakeUser()
 
-	id1, err := st.store.Register(ctx, newUser1)
+	id1, err := st.store.Register(ctx, user1)
 	require.NoError(t, err)
 	assert.NotEmpty(t, id1)
 
-	id2, err := st.store.Register(ctx, newUser2)
+	id2, err := st.store.Register(ctx, user2)
 	require.NoError(t, err)
 	assert.NotEmpty(t, id2)
 
-	user1, err := st.store.UserByID(ctx, id1)
+	deposit, err := st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       fakeAmount(),
+	})
 	require.NoError(t, err)
-	assert.NotEmpty(t, user1)
 
-	user2, err := st.store.UserByID(ctx, id2)
+	transfer, err := st.store.Transfer(ctx, &TransactionRequest{
+		Type:           transferTransaction,
+		FromCardNumber: user1.Accounts[0].Cards[0].Number,
+		ToCardNumber:   user2.Accounts[0].Cards[0].Number,
+		Amount:         minAmount,
+	})
 	require.NoError(t, err)
-	assert.NotEmpty(t, user2)
 
-	deposit := TransactionRequest{
-		Type:         depositTransaction,
-		ToCardNumber: user1.Account.Card.Number,
-		Amount:       gofakeit.Price(minAmount, maxAmount),
+	pool := st.store.(*Storage).pool
+
+	for _, id := range []any{deposit.ID, transfer.ID} {
+		var (
+			count int
+			sum   Money
+		)
+		err := pool.QueryRow(ctx, `SELECT COUNT(*), SUM(amount)::BIGINT FROM postings WHERE transaction_id = $1`, id).Scan(&count, &sum)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+		assert.Zero(t, sum)
 	}
 
-	tr, err := st.store.Deposit(ctx, &deposit)
+	for _, id := range []int{id1, id2} {
+		u, err := st.store.UserByID(ctx, id)
+		require.NoError(t, err)
+
+		var ledgerBalance Money
+		err = pool.QueryRow(ctx, `SELECT balance FROM ledger_balances WHERE account_id = $1`, u.Accounts[0].ID).Scan(&ledgerBalance)
+		require.NoError(t, err)
+		assert.Equal(t, u.Accounts[0].Balance, ledgerBalance)
+	}
+}
+
+func TestMultiCurrency(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user1 := fakeUser()
+	user2 := fakeUser()
+
+	id1, err := st.store.Register(ctx, user1)
 	require.NoError(t, err)
-	assert.NotEmpty(t, tr)
 
-	user1, err = st.store.UserByID(ctx, id1)
+	id2, err := st.store.Register(ctx, user2)
 	require.NoError(t, err)
-	assert.NotEmpty(t, user2)
+
+	euros := NewAccount(checkingAccount, "EUR")
+	require.NoError(t, st.store.OpenAccount(ctx, id2, &euros))
+
+	pounds := NewAccount(checkingAccount, "GBP")
+	require.NoError(t, st.store.OpenAccount(ctx, id2, &pounds))
+
+	yen := NewAccount(checkingAccount, "JPY")
+	err = st.store.OpenAccount(ctx, id2, &yen)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, UnsupportedCurrency("JPY").Error())
+
+	dollarCard := user1.Accounts[0].Cards[0].Number
+	euroCard := euros.Cards[0].Number
+
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: dollarCard,
+		Amount:       1000,
+		Currency:     "EUR",
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CurrencyMismatch(dollarCard, defaultCurrency, "EUR").Error())
+	assert.NotContains(t, err.Error(), dollarCard)
+
+	deposit, err := st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: dollarCard,
+		Amount:       1000,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, defaultCurrency, deposit.Currency)
 
 	transfer := TransactionRequest{
 		Type:           transferTransaction,
-		FromCardNumber: user1.Account.Card.Number,
-		ToCardNumber:   user2.Account.Card.Number,
-		Amount:         user1.Account.Balance,
+		FromCardNumber: dollarCard,
+		ToCardNumber:   euroCard,
+		Amount:         500,
 	}
 
-	tr, err = st.store.Transfer(ctx, &transfer)
+	_, err = st.store.Transfer(ctx, &transfer)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, ConversionRequired(defaultCurrency, "EUR").Error())
+
+	_, err = st.store.Transfer(ctx, &TransactionRequest{
+		Type:           transferTransaction,
+		FromCardNumber: dollarCard,
+		ToCardNumber:   pounds.Cards[0].Number,
+		Amount:         500,
+		Convert:        true,
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, NoExchangeRate(defaultCurrency, "GBP").Error())
+
+	_, err = st.store.SetExchangeRate(ctx, &ExchangeRate{Base: "JPY", Quote: "EUR", Rate: "0.006"})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, UnsupportedCurrency("JPY").Error())
+
+	rate, err := st.store.SetExchangeRate(ctx, &ExchangeRate{Base: defaultCurrency, Quote: "EUR", Rate: "0.9"})
 	require.NoError(t, err)
-	assert.NotEmpty(t, tr)
+	assert.Equal(t, "0.90000000", rate.Rate)
 
-	user1Trs, err := st.store.TransactionsByUser(ctx, user1.ID)
+	transfer.Convert = true
+	converted, err := st.store.Transfer(ctx, &transfer)
+	require.NoError(t, err)
+	assert.Equal(t, Money(500), converted.Amount)
+	assert.Equal(t, defaultCurrency, converted.Currency)
+	require.NotNil(t, converted.Conversion)
+	assert.Equal(t, Conversion{Amount: 450, Currency: "EUR", Rate: "0.90000000"}, *converted.Conversion)
+
+	_, err = st.store.Withdraw(ctx, &TransactionRequest{
+		Type:           withdrawalTransaction,
+		FromCardNumber: euroCard,
+		Amount:         500,
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, InsufficientFunds(450, 500, "EUR").Error())
+
+	pool := st.store.(*Storage).pool
+
+	// Each currency's legs balance on their own through the fx accounts.
+	rows, err := pool.Query(ctx, `SELECT accounts.currency, COUNT(*), SUM(postings.amount)::BIGINT
+								  FROM postings
+								  JOIN accounts ON postings.account_id = accounts.id
+								  WHERE postings.transaction_id = $1
+								  GROUP BY accounts.currency`, converted.ID)
+	require.NoError(t, err)
+
+	legs := make(map[string]int)
+	for rows.Next() {
+		var (
+			currency string
+			count    int
+			sum      Money
+		)
+		require.NoError(t, rows.Scan(&currency, &count, &sum))
+		assert.Zero(t, sum, currency)
+		legs[currency] = count
+	}
+	rows.Close()
+	require.NoError(t, rows.Err())
+	assert.Equal(t, map[string]int{defaultCurrency: 2, "EUR": 2}, legs)
+
+	reversal, err := st.store.Reverse(ctx, &ReversalRequest{TransactionID: converted.ID, Amount: 200})
+	require.NoError(t, err)
+	assert.Equal(t, defaultCurrency, reversal.Currency)
+	require.NotNil(t, reversal.Conversion)
+	assert.Equal(t, Money(180), reversal.Conversion.Amount)
+
+	u1, err := st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	assert.Equal(t, defaultCurrency, u1.Accounts[0].Currency)
+	assert.Equal(t, Money(700), u1.Accounts[0].Balance)
+
+	account, err := st.store.AccountByID(ctx, euros.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", account.Currency)
+	assert.Equal(t, Money(270), account.Balance)
+
+	transactions, err := st.store.TransactionsByUser(ctx, id2)
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+	assert.Equal(t, reversal.ID, transactions[0].ID)
+	assert.Equal(t, converted.Conversion, transactions[1].Conversion)
+}
+
+func TestWithdraw(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user := fakeUser()
+
+	id, err := st.store.Register(ctx, user)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	deposit := TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user.Accounts[0].Cards[0].Number,
+		Amount:       fakeAmount(),
+	}
+
+	tr, err := st.store.Deposit(ctx, &deposit)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tr)
+
+	withdrawal := TransactionRequest{
+		Type:           withdrawalTransaction,
+		FromCardNumber: user.Accounts[0].Cards[0].Number,
+		Amount:         deposit.Amount * 2,
+	}
+
+	tr, err = st.store.Withdraw(ctx, &withdrawal)
+	require.Error(t, err)
+	assert.Empty(t, tr)
+	assert.ErrorContains(t, err, InsufficientFunds(deposit.Amount, withdrawal.Amount, defaultCurrency).Error())
+
+	withdrawal.Amount = deposit.Amount
+
+	tr, err = st.store.Withdraw(ctx, &withdrawal)
+	require.NoError(t, err)
+	assert.Equal(t, withdrawalTransaction, tr.Type)
+	assert.Equal(t, user.Accounts[0].Cards[0].Number, tr.FromCardNumber)
+	assert.Empty(t, tr.ToCardNumber)
+
+	u, err := st.store.UserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Empty(t, u.Accounts[0].Balance)
+
+	trs, err := st.store.TransactionsByUser(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, trs, 2)
+	assert.Equal(t, tr.ID, trs[0].ID)
+
+	card := gofakeit.CreditCard()
+
+	tr, err = st.store.Withdraw(ctx, &TransactionRequest{
+		Type:           withdrawalTransaction,
+		FromCardNumber: strconv.Itoa(card.Number),
+		Amount:         minAmount,
+	})
+	require.Error(t, err)
+	assert.Empty(t, tr)
+	assert.ErrorContains(t, err, NoAccount(strconv.Itoa(card.Number)).Error())
+	assert.NotContains(t, err.Error(), strconv.Itoa(card.Number))
+}
+
+func TestReverse(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user1 := fakeUser()
+	user2 := fakeUser()
+
+	id1, err := st.store.Register(ctx, user1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id1)
+
+	id2, err := st.store.Register(ctx, user2)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id2)
+
+	const amount Money = 1000
+
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       amount,
+	})
+	require.NoError(t, err)
+
+	transfer, err := st.store.Transfer(ctx, &TransactionRequest{
+		Type:           transferTransaction,
+		FromCardNumber: user1.Accounts[0].Cards[0].Number,
+		ToCardNumber:   user2.Accounts[0].Cards[0].Number,
+		Amount:         amount,
+	})
+	require.NoError(t, err)
+
+	partial, err := st.store.Reverse(ctx, &ReversalRequest{TransactionID: transfer.ID, Amount: amount / 4})
+	require.NoError(t, err)
+	assert.Equal(t, reversalTransaction, partial.Type)
+	assert.Equal(t, amount/4, partial.Amount)
+	require.NotNil(t, partial.ReversalOf)
+	assert.Equal(t, transfer.ID, *partial.ReversalOf)
+	assert.Equal(t, user2.Accounts[0].Cards[0].Number, partial.FromCardNumber)
+	assert.Equal(t, user1.Accounts[0].Cards[0].Number, partial.ToCardNumber)
+
+	tr, err := st.store.Reverse(ctx, &ReversalRequest{TransactionID: transfer.ID, Amount: amount})
+	require.Error(t, err)
+	assert.Empty(t, tr)
+	assert.ErrorContains(t, err, RefundExceeds(amount-amount/4, amount).Error())
+
+	tr, err = st.store.Reverse(ctx, &ReversalRequest{TransactionID: partial.ID})
+	require.Error(t, err)
+	assert.Empty(t, tr)
+	assert.ErrorContains(t, err, NotReversible().Error())
+
+	_, err = st.store.Withdraw(ctx, &TransactionRequest{
+		Type:           withdrawalTransaction,
+		FromCardNumber: user2.Accounts[0].Cards[0].Number,
+		Amount:         amount / 2,
+	})
+	require.NoError(t, err)
+
+	tr, err = st.store.Reverse(ctx, &ReversalRequest{TransactionID: transfer.ID})
+	require.Error(t, err)
+	assert.Empty(t, tr)
+	assert.ErrorContains(t, err, InsufficientFunds(amount/4, amount-amount/4, defaultCurrency).Error())
+
+	rest, err := st.store.Reverse(ctx, &ReversalRequest{TransactionID: transfer.ID, Amount: amount / 4})
+	require.NoError(t, err)
+	assert.Equal(t, amount/4, rest.Amount)
+
+	u1, err := st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	assert.Equal(t, amount/2, u1.Accounts[0].Balance)
+
+	u2, err := st.store.UserByID(ctx, id2)
+	require.NoError(t, err)
+	assert.Empty(t, u2.Accounts[0].Balance)
+
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user2.Accounts[0].Cards[0].Number,
+		Amount:       amount,
+	})
+	require.NoError(t, err)
+
+	_, err = st.store.Reverse(ctx, &ReversalRequest{TransactionID: transfer.ID})
+	require.NoError(t, err)
+
+	tr, err = st.store.Reverse(ctx, &ReversalRequest{TransactionID: transfer.ID})
+	require.Error(t, err)
+	assert.Empty(t, tr)
+	assert.ErrorContains(t, err, AlreadyReversed().Error())
+
+	fakeID := uuid.New()
+
+	tr, err = st.store.Reverse(ctx, &ReversalRequest{TransactionID: fakeID})
+	require.Error(t, err)
+	assert.Empty(t, tr)
+	assert.ErrorContains(t, err, NoTransaction(fakeID).Error())
+}
+
+func TestHolds(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	customer := fakeUser()
+	merchant := fakeUser()
+
+	id1, err := st.store.Register(ctx, customer)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id1)
+
+	id2, err := st.store.Register(ctx, merchant)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id2)
+
+	const amount Money = 1000
+
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: customer.Accounts[0].Cards[0].Number,
+		Amount:       amount,
+	})
+	require.NoError(t, err)
+
+	_, err = st.store.PlaceHold(ctx, &HoldRequest{
+		CardNumber:         customer.Accounts[0].Cards[0].Number,
+		CardExpireTime:     customer.Accounts[0].Cards[0].ExpireTime.Format(layout),
+		CVV:                wrongCVV(customer.Accounts[0].Cards[0].CVV),
+		MerchantCardNumber: merchant.Accounts[0].Cards[0].Number,
+		Amount:             amount / 4,
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardVerificationFailed().Error())
+
+	hold, err := st.store.PlaceHold(ctx, &HoldRequest{
+		CardNumber:         customer.Accounts[0].Cards[0].Number,
+		CardExpireTime:     customer.Accounts[0].Cards[0].ExpireTime.Format(layout),
+		CVV:                customer.Accounts[0].Cards[0].CVV,
+		MerchantCardNumber: merchant.Accounts[0].Cards[0].Number,
+		Amount:             amount * 3 / 4,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, holdPending, hold.Status)
+
+	u1, err := st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	assert.Equal(t, amount, u1.Accounts[0].Balance)
+	assert.Equal(t, amount/4, u1.Accounts[0].AvailableBalance)
+
+	tr, err := st.store.Transfer(ctx, &TransactionRequest{
+		Type:           transferTransaction,
+		FromCardNumber: customer.Accounts[0].Cards[0].Number,
+		ToCardNumber:   merchant.Accounts[0].Cards[0].Number,
+		Amount:         amount / 2,
+	})
+	require.Error(t, err)
+	assert.Empty(t, tr)
+	assert.ErrorContains(t, err, InsufficientFunds(amount/4, amount/2, defaultCurrency).Error())
+
+	_, err = st.store.PlaceHold(ctx, &HoldRequest{
+		CardNumber:         customer.Accounts[0].Cards[0].Number,
+		CardExpireTime:     customer.Accounts[0].Cards[0].ExpireTime.Format(layout),
+		CVV:                customer.Accounts[0].Cards[0].CVV,
+		MerchantCardNumber: merchant.Accounts[0].Cards[0].Number,
+		Amount:             amount / 2,
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, InsufficientFunds(amount/4, amount/2, defaultCurrency).Error())
+
+	tr, err = st.store.CaptureHold(ctx, &CaptureRequest{HoldID: hold.ID, Amount: amount})
+	require.Error(t, err)
+	assert.Empty(t, tr)
+	assert.ErrorContains(t, err, CaptureExceeds(amount*3/4, amount).Error())
+
+	tr, err = st.store.CaptureHold(ctx, &CaptureRequest{HoldID: hold.ID, Amount: amount / 2})
+	require.NoError(t, err)
+	assert.Equal(t, captureTransaction, tr.Type)
+	assert.Equal(t, amount/2, tr.Amount)
+
+	u1, err = st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	assert.Equal(t, amount/2, u1.Accounts[0].Balance)
+	assert.Equal(t, amount/2, u1.Accounts[0].AvailableBalance)
+
+	u2, err := st.store.UserByID(ctx, id2)
+	require.NoError(t, err)
+	assert.Equal(t, amount/2, u2.Accounts[0].Balance)
+
+	captured, err := st.store.HoldByID(ctx, hold.ID)
+	require.NoError(t, err)
+	assert.Equal(t, holdCaptured, captured.Status)
+	assert.Equal(t, amount/2, captured.CapturedAmount)
+
+	_, err = st.store.ReleaseHold(ctx, hold.ID)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, HoldNotPending(holdCaptured).Error())
+
+	hold, err = st.store.PlaceHold(ctx, &HoldRequest{
+		CardNumber:         customer.Accounts[0].Cards[0].Number,
+		CardExpireTime:     customer.Accounts[0].Cards[0].ExpireTime.Format(layout),
+		CVV:                customer.Accounts[0].Cards[0].CVV,
+		MerchantCardNumber: merchant.Accounts[0].Cards[0].Number,
+		Amount:             amount / 2,
+	})
+	require.NoError(t, err)
+
+	released, err := st.store.ReleaseHold(ctx, hold.ID)
+	require.NoError(t, err)
+	assert.Equal(t, holdReleased, released.Status)
+
+	u1, err = st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	assert.Equal(t, amount/2, u1.Accounts[0].AvailableBalance)
+
+	expiresAt := time.Now().Add(time.Second)
+	hold, err = st.store.PlaceHold(ctx, &HoldRequest{
+		CardNumber:         customer.Accounts[0].Cards[0].Number,
+		CardExpireTime:     customer.Accounts[0].Cards[0].ExpireTime.Format(layout),
+		CVV:                customer.Accounts[0].Cards[0].CVV,
+		MerchantCardNumber: merchant.Accounts[0].Cards[0].Number,
+		Amount:             amount / 2,
+		ExpiresAt:          &expiresAt,
+	})
+	require.NoError(t, err)
+
+	time.Sleep(time.Until(expiresAt))
+
+	u1, err = st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	assert.Equal(t, amount/2, u1.Accounts[0].AvailableBalance)
+
+	_, err = st.store.ExpireHolds(ctx)
+	require.NoError(t, err)
+
+	expired, err := st.store.HoldByID(ctx, hold.ID)
+	require.NoError(t, err)
+	assert.Equal(t, holdExpired, expired.Status)
+
+	fakeID := uuid.New()
+
+	_, err = st.store.HoldByID(ctx, fakeID)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, NoHold(fakeID).Error())
+}
+
+func TestScheduledTransfers(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user1 := fakeUser()
+	user2 := fakeUser()
+
+	id1, err := st.store.Register(ctx, user1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id1)
+
+	id2, err := st.store.Register(ctx, user2)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id2)
+
+	const amount Money = 1000
+
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       amount,
+	})
+	require.NoError(t, err)
+
+	past := time.Now().Add(-time.Second)
+	future := time.Now().Add(time.Hour)
+
+	schedule := func(amount Money, executeAt time.Time) ScheduledTransfer {
+		scheduled, err := st.store.ScheduleTransfer(ctx, &TransactionRequest{
+			Type:           transferTransaction,
+			FromCardNumber: user1.Accounts[0].Cards[0].Number,
+			ToCardNumber:   user2.Accounts[0].Cards[0].Number,
+			Amount:         amount,
+			ExecuteAt:      &executeAt,
+			UserID:         id1,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, scheduledPending, scheduled.Status)
+		return scheduled
+	}
+
+	due := schedule(amount, past)
+	overdrawn := schedule(amount, past)
+	later := schedule(amount, future)
+
+	srv := NewServer("", st.store, nil)
+	srv.executeDueTransfers(ctx)
+
+	executed, err := st.store.ScheduledTransferByID(ctx, due.ID)
+	require.NoError(t, err)
+
+	failed, err := st.store.ScheduledTransferByID(ctx, overdrawn.ID)
+	require.NoError(t, err)
+
+	// Both transfers were due at the same time, either one may have run first.
+	if executed.Status == scheduledFailed {
+		executed, failed = failed, executed
+	}
+
+	assert.Equal(t, scheduledExecuted, executed.Status)
+	require.NotNil(t, executed.TransactionID)
+	assert.NotNil(t, executed.ExecutedAt)
+
+	assert.Equal(t, scheduledFailed, failed.Status)
+	assert.Contains(t, failed.FailureReason, "insufficient funds")
+	assert.Nil(t, failed.TransactionID)
+
+	pending, err := st.store.ScheduledTransferByID(ctx, later.ID)
+	require.NoError(t, err)
+	assert.Equal(t, scheduledPending, pending.Status)
+
+	u2, err := st.store.UserByID(ctx, id2)
+	require.NoError(t, err)
+	assert.Equal(t, amount, u2.Accounts[0].Balance)
+
+	cancelled, err := st.store.CancelScheduledTransfer(ctx, later.ID)
+	require.NoError(t, err)
+	assert.Equal(t, scheduledCancelled, cancelled.Status)
+
+	_, err = st.store.CancelScheduledTransfer(ctx, later.ID)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, ScheduledTransferNotPending(scheduledCancelled).Error())
+
+	_, err = st.store.CancelScheduledTransfer(ctx, executed.ID)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, ScheduledTransferNotPending(scheduledExecuted).Error())
+
+	fakeID := uuid.New()
+
+	_, err = st.store.ScheduledTransferByID(ctx, fakeID)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, NoScheduledTransfer(fakeID).Error())
+
+	req := &TransactionRequest{
+		Type:           transferTransaction,
+		FromCardNumber: user1.Accounts[0].Cards[0].Number,
+		ToCardNumber:   user2.Accounts[0].Cards[0].Number,
+		Amount:         amount,
+		ExecuteAt:      &future,
+		UserID:         id1,
+		IdempotencyKey: gofakeit.UUID(),
+	}
+
+	first, err := st.store.ScheduleTransfer(ctx, req)
+	require.NoError(t, err)
+
+	retried, err := st.store.ScheduleTransfer(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, retried.ID)
+
+	req.Amount = amount / 2
+
+	_, err = st.store.ScheduleTransfer(ctx, req)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, IdempotencyKeyReused().Error())
+}
+
+func TestStandingOrders(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user1 := fakeUser()
+	user2 := fakeUser()
+
+	id1, err := st.store.Register(ctx, user1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id1)
+
+	id2, err := st.store.Register(ctx, user2)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id2)
+
+	const amount Money = 1000
+
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       amount,
+	})
+	require.NoError(t, err)
+
+	start := time.Now().Add(-time.Minute)
+
+	create := func() StandingOrder {
+		order := NewStandingOrder(&StandingOrderRequest{
+			FromCardNumber: user1.Accounts[0].Cards[0].Number,
+			ToCardNumber:   user2.Accounts[0].Cards[0].Number,
+			Amount:         amount,
+			Frequency:      frequencyDaily,
+			StartAt:        start,
+			UserID:         id1,
+		})
+		require.NoError(t, st.store.CreateStandingOrder(ctx, &order))
+		assert.NotEmpty(t, order.ID)
+		return order
+	}
+
+	first := create()
+	second := create()
+
+	orders, err := st.store.StandingOrdersByUser(ctx, id1)
+	require.NoError(t, err)
+	assert.Len(t, orders, 2)
+
+	srv := NewServer("", st.store, nil)
+	srv.executeDueStandingOrders(ctx)
+
+	runs1, err := st.store.StandingOrderRuns(ctx, first.ID)
+	require.NoError(t, err)
+	require.Len(t, runs1, 1)
+
+	runs2, err := st.store.StandingOrderRuns(ctx, second.ID)
+	require.NoError(t, err)
+	require.Len(t, runs2, 1)
+
+	// Both orders were due at the same time, either one may have run first.
+	if runs1[0].Status == runFailed {
+		runs1, runs2 = runs2, runs1
+	}
+
+	assert.Equal(t, runExecuted, runs1[0].Status)
+	assert.NotNil(t, runs1[0].TransactionID)
+	assert.Equal(t, 1, runs1[0].Attempt)
+
+	assert.Equal(t, runFailed, runs2[0].Status)
+	assert.Contains(t, runs2[0].FailureReason, "insufficient funds")
+	assert.Nil(t, runs2[0].TransactionID)
+
+	for _, id := range []uuid.UUID{first.ID, second.ID} {
+		order, err := st.store.StandingOrderByID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, standingOrderActive, order.Status)
+		assert.WithinDuration(t, start.AddDate(0, 0, 1), order.NextRunAt, time.Second)
+	}
+
+	u2, err := st.store.UserByID(ctx, id2)
+	require.NoError(t, err)
+	assert.Equal(t, amount, u2.Accounts[0].Balance)
+
+	newAmount := amount / 2
+	updated, err := st.store.UpdateStandingOrder(ctx, &StandingOrderUpdate{
+		ID:     first.ID,
+		Amount: &newAmount,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, newAmount, updated.Amount)
+
+	cancelled, err := st.store.CancelStandingOrder(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, standingOrderCancelled, cancelled.Status)
+
+	_, err = st.store.CancelStandingOrder(ctx, first.ID)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, StandingOrderNotActive(standingOrderCancelled).Error())
+
+	_, err = st.store.UpdateStandingOrder(ctx, &StandingOrderUpdate{
+		ID:     first.ID,
+		Amount: &newAmount,
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, StandingOrderNotActive(standingOrderCancelled).Error())
+
+	fakeID := uuid.New()
+
+	_, err = st.store.StandingOrderByID(ctx, fakeID)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, NoStandingOrder(fakeID).Error())
+}
+
+func TestInterest(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	saver := fakeUser()
+	spender := fakeUser()
+
+	saverID, err := st.store.Register(ctx, saver)
+	require.NoError(t, err)
+	assert.NotEmpty(t, saverID)
+
+	spenderID, err := st.store.Register(ctx, spender)
+	require.NoError(t, err)
+	assert.NotEmpty(t, spenderID)
+
+	// 2.5% a year on 3650.00 is exactly 0.25 a day.
+	const (
+		balance Money = 365000
+		daily   Money = 25
+	)
+
+	for _, card := range []string{saver.Accounts[0].Cards[0].Number, spender.Accounts[0].Cards[0].Number} {
+		_, err = st.store.Deposit(ctx, &TransactionRequest{
+			Type:         depositTransaction,
+			ToCardNumber: card,
+			Amount:       balance,
+		})
+		require.NoError(t, err)
+	}
+
+	pool := st.store.(*Storage).pool
+	_, err = pool.Exec(ctx, `UPDATE accounts SET account_type = $2 WHERE user_id = $1`, saverID, savingsAccount)
+	require.NoError(t, err)
+
+	rate, err := st.store.SetInterestRate(ctx, &InterestRate{AccountType: savingsAccount, AnnualRateBps: 250})
+	require.NoError(t, err)
+	assert.Equal(t, 250, rate.AnnualRateBps)
+
+	year, month, day := time.Now().UTC().Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	nextMonth := time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC)
+	days := int(nextMonth.Sub(today).Hours() / 24)
+
+	clock := &fakeClock{now: nextMonth.Add(-time.Hour)}
+	srv := NewServer("", st.store, nil)
+	srv.clock = clock
+
+	// The last day of the month hasn't ended yet, nothing is capitalized.
+	srv.accrueInterest(ctx)
+
+	var accrued int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT COUNT(*) FROM interest_accruals WHERE account_id = $1`, saver.Accounts[0].ID).Scan(&accrued))
+	assert.Equal(t, days-1, accrued)
+
+	u, err := st.store.UserByID(ctx, saverID)
+	require.NoError(t, err)
+	assert.Equal(t, balance, u.Accounts[0].Balance)
+	assert.Equal(t, savingsAccount, u.Accounts[0].Type)
+
+	clock.now = nextMonth.Add(time.Hour)
+	srv.accrueInterest(ctx)
+	srv.accrueInterest(ctx)
+
+	u, err = st.store.UserByID(ctx, saverID)
+	require.NoError(t, err)
+	assert.Equal(t, balance+daily*Money(days), u.Accounts[0].Balance)
+
+	trs, err := st.store.TransactionsByUser(ctx, saverID)
+	require.NoError(t, err)
+	require.Len(t, trs, 2)
+	assert.Equal(t, interestTransaction, trs[0].Type)
+	assert.Equal(t, daily*Money(days), trs[0].Amount)
+	assert.Equal(t, saver.Accounts[0].Cards[0].Number, trs[0].ToCardNumber)
+
+	u, err = st.store.UserByID(ctx, spenderID)
+	require.NoError(t, err)
+	assert.Equal(t, balance, u.Accounts[0].Balance)
+	assert.Equal(t, checkingAccount, u.Accounts[0].Type)
+
+	_, err = st.store.SetInterestRate(ctx, &InterestRate{AccountType: "premium", AnnualRateBps: 100})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, NoAccountType("premium").Error())
+}
+
+func TestUserByID(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	newUser := fakeUser()
+
+	id, err := st.store.Register(ctx, newUser)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	user, err := st.store.UserByID(ctx, id)
+	require.NoError(t, err)
+	assert.NotEmpty(t, user)
+
+	fakeId := gofakeit.Uint8()
+
+	fakeUser, err := st.store.UserByID(ctx, int(fakeId))
+	require.Error(t, err)
+	assert.Empty(t, fakeUser)
+	assert.ErrorContains(t, err, NoUser().Error())
+}
+
+func TestOpenAccount(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	newUser := fakeUser()
+
+	id, err := st.store.Register(ctx, newUser)
+	require.NoError(t, err)
+	assert.Equal(t, newUser.ID, id)
+
+	savings := NewAccount(savingsAccount, defaultCurrency)
+	require.NoError(t, st.store.OpenAccount(ctx, id, &savings))
+	assert.NotEmpty(t, savings.ID)
+	assert.NotEmpty(t, savings.Cards[0].ID)
+
+	user, err := st.store.UserByID(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, user.Accounts, 2)
+	assert.Equal(t, newUser.Accounts[0].ID, user.Accounts[0].ID)
+	assert.Equal(t, checkingAccount, user.Accounts[0].Type)
+	assert.Equal(t, savings.ID, user.Accounts[1].ID)
+	assert.Equal(t, savingsAccount, user.Accounts[1].Type)
+
+	account, err := st.store.AccountByID(ctx, savings.ID)
+	require.NoError(t, err)
+	assert.Equal(t, id, account.UserID)
+	assert.Equal(t, savings.Cards[0].Number, account.Cards[0].Number)
+
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: newUser.Accounts[0].Cards[0].Number,
+		Amount:       1000,
+	})
+	require.NoError(t, err)
+
+	_, err = st.store.Transfer(ctx, &TransactionRequest{
+		Type:           transferTransaction,
+		FromCardNumber: newUser.Accounts[0].Cards[0].Number,
+		ToCardNumber:   account.Cards[0].Number,
+		Amount:         400,
+	})
+	require.NoError(t, err)
+
+	user, err = st.store.UserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, Money(600), user.Accounts[0].Balance)
+	assert.Equal(t, Money(400), user.Accounts[1].Balance)
+
+	orphan := NewAccount(checkingAccount, defaultCurrency)
+	err = st.store.OpenAccount(ctx, -1, &orphan)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, NoUser().Error())
+
+	_, err = st.store.AccountByID(ctx, -1)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, NoAccountID(-1).Error())
+}
+
+func TestIssueCard(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user1 := fakeUser()
+	user2 := fakeUser()
+
+	id1, err := st.store.Register(ctx, user1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id1)
+
+	_, err = st.store.Register(ctx, user2)
+	require.NoError(t, err)
+
+	accountID := user1.Accounts[0].ID
+
+	virtual := NewCard()
+	virtual.Kind = cardVirtual
+	require.NoError(t, st.store.IssueCard(ctx, accountID, &virtual))
+	assert.NotEmpty(t, virtual.ID)
+
+	cards, err := st.store.CardsByAccount(ctx, accountID)
+	require.NoError(t, err)
+	require.Len(t, cards, 2)
+	assert.Equal(t, cardPhysical, cards[0].Kind)
+	assert.Equal(t, cardVirtual, cards[1].Kind)
+	assert.Equal(t, virtual.Number, cards[1].Number)
+
+	ownerID, err := st.store.CardOwner(ctx, virtual.Number)
+	require.NoError(t, err)
+	assert.Equal(t, id1, ownerID)
+
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       1000,
+	})
+	require.NoError(t, err)
+
+	_, err = st.store.Transfer(ctx, &TransactionRequest{
+		Type:           transferTransaction,
+		FromCardNumber: virtual.Number,
+		ToCardNumber:   user2.Accounts[0].Cards[0].Number,
+		Amount:         300,
+	})
+	require.NoError(t, err)
+
+	user, err := st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	require.Len(t, user.Accounts, 1)
+	assert.Len(t, user.Accounts[0].Cards, 2)
+	assert.Equal(t, Money(700), user.Accounts[0].Balance)
+
+	orphan := NewCard()
+	err = st.store.IssueCard(ctx, -1, &orphan)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, NoAccountID(-1).Error())
+}
+
+func TestCardLifecycle(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user1 := fakeUser()
+	user2 := fakeUser()
+
+	id1, err := st.store.Register(ctx, user1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id1)
+
+	_, err = st.store.Register(ctx, user2)
+	require.NoError(t, err)
+
+	card := user1.Accounts[0].Cards[0]
+	recipient := user2.Accounts[0].Cards[0].Number
+
+	deposit := func(cardNumber string) error {
+		_, err := st.store.Deposit(ctx, &TransactionRequest{
+			Type:         depositTransaction,
+			ToCardNumber: cardNumber,
+			Amount:       1000,
+		})
+		return err
+	}
+
+	transfer := func(cardNumber string) error {
+		_, err := st.store.Transfer(ctx, &TransactionRequest{
+			Type:           transferTransaction,
+			FromCardNumber: cardNumber,
+			ToCardNumber:   recipient,
+			Amount:         100,
+		})
+		return err
+	}
+
+	require.NoError(t, deposit(card.Number))
+
+	frozen, err := st.store.UpdateCardStatus(ctx, card.ID, []string{cardActive}, cardFrozen)
+	require.NoError(t, err)
+	assert.Equal(t, cardFrozen, frozen.Status)
+
+	err = transfer(card.Number)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardNotActive(card.Number, cardFrozen).Error())
+
+	err = deposit(card.Number)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardNotActive(card.Number, cardFrozen).Error())
+
+	_, err = st.store.UpdateCardStatus(ctx, card.ID, []string{cardActive}, cardFrozen)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardStatusConflict(cardFrozen, cardFrozen).Error())
+
+	_, err = st.store.UpdateCardStatus(ctx, card.ID, []string{cardFrozen}, cardActive)
+	require.NoError(t, err)
+	require.NoError(t, transfer(card.Number))
+
+	replacement := NewCard()
+	require.NoError(t, st.store.ReplaceCard(ctx, card.ID, &replacement))
+	assert.NotEmpty(t, replacement.ID)
+	assert.Equal(t, card.Kind, replacement.Kind)
+
+	old, err := st.store.CardByID(ctx, card.ID)
+	require.NoError(t, err)
+	assert.Equal(t, cardBlocked, old.Status)
+
+	err = transfer(card.Number)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardNotActive(card.Number, cardBlocked).Error())
+
+	require.NoError(t, transfer(replacement.Number))
+
+	_, err = st.store.UpdateCardStatus(ctx, card.ID, []string{cardFrozen}, cardActive)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardStatusConflict(cardBlocked, cardActive).Error())
+
+	err = st.store.ReplaceCard(ctx, card.ID, &Card{})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardStatusConflict(cardBlocked, cardBlocked).Error())
+
+	user, err := st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	assert.Equal(t, Money(800), user.Accounts[0].Balance)
+
+	_, err = st.store.CardByID(ctx, -1)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, NoCard(-1).Error())
+}
+
+func TestCardExpiry(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user1 := fakeUser()
+	user2 := fakeUser()
+
+	id1, err := st.store.Register(ctx, user1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id1)
+
+	_, err = st.store.Register(ctx, user2)
+	require.NoError(t, err)
+
+	card := user1.Accounts[0].Cards[0]
+	recipient := user2.Accounts[0].Cards[0]
+
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: card.Number,
+		Amount:       1000,
+	})
+	require.NoError(t, err)
+
+	pool := st.store.(*Storage).pool
+	_, err = pool.Exec(ctx, `UPDATE cards SET expire_time = CURRENT_DATE + 10 WHERE id = $1`, card.ID)
+	require.NoError(t, err)
+
+	srv := NewServer("", st.store, nil)
+	srv.clock = &fakeClock{now: time.Now()}
+
+	srv.reissueExpiringCards(ctx)
+	srv.reissueExpiringCards(ctx)
+
+	cards, err := st.store.CardsByAccount(ctx, user1.Accounts[0].ID)
+	require.NoError(t, err)
+	require.Len(t, cards, 2)
+
+	notifications, err := st.store.NotificationsByUser(ctx, id1)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+
+	// The replacement has no CVV until its owner activates it.
+	replacement := cards[0]
+	if replacement.ID == card.ID {
+		replacement = cards[1]
+	}
+
+	for _, cvv := range []string{"", "000", "111"} {
+		err = st.store.VerifyCard(ctx, &CardVerificationRequest{CardNumber: replacement.Number, ExpireTime: replacement.ExpireTime.Format(layout), CVV: cvv})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, CardVerificationFailed().Error())
+	}
+
+	replacement.CVV = newCVV()
+	require.NoError(t, st.store.ActivateCard(ctx, &replacement))
+	require.NoError(t, st.store.VerifyCard(ctx, &CardVerificationRequest{CardNumber: replacement.Number, ExpireTime: replacement.ExpireTime.Format(layout), CVV: replacement.CVV}))
+
+	err = st.store.ActivateCard(ctx, &replacement)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardAlreadyActivated(replacement.ID).Error())
+
+	cards, err = st.store.CardsByAccount(ctx, user2.Accounts[0].ID)
+	require.NoError(t, err)
+	assert.Len(t, cards, 1)
+
+	// The old card keeps working until it expires.
+	_, err = st.store.Transfer(ctx, &TransactionRequest{
+		Type:           transferTransaction,
+		FromCardNumber: card.Number,
+		ToCardNumber:   recipient.Number,
+		Amount:         100,
+	})
+	require.NoError(t, err)
+
+	_, err = pool.Exec(ctx, `UPDATE cards SET expire_time = CURRENT_DATE - 1 WHERE id = $1`, card.ID)
+	require.NoError(t, err)
+
+	_, err = st.store.Transfer(ctx, &TransactionRequest{
+		Type:           transferTransaction,
+		FromCardNumber: card.Number,
+		ToCardNumber:   recipient.Number,
+		Amount:         100,
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardExpired(card.Number).Error())
+
+	err = st.store.ReissueCard(ctx, card.ID, &Card{})
+	require.Error(t, err)
+}
+
+func TestVerifyCard(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	newUser := fakeUser()
+
+	id, err := st.store.Register(ctx, newUser)
+	require.NoError(t, err)
+
+	card := newUser.Accounts[0].Cards[0]
+	expireTime := card.ExpireTime.Format(layout)
+
+	var stored string
+	pool := st.store.(*Storage).pool
+	require.NoError(t, pool.QueryRow(ctx, `SELECT cvv_hash FROM cards WHERE id = $1`, card.ID).Scan(&stored))
+	assert.NotEqual(t, card.CVV, stored)
+
+	user, err := st.store.UserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Empty(t, user.Accounts[0].Cards[0].CVV)
+
+	require.NoError(t, st.store.VerifyCard(ctx, &CardVerificationRequest{CardNumber: card.Number, ExpireTime: expireTime, CVV: card.CVV}))
+
+	wrong := wrongCVV(card.CVV)
+
+	err = st.store.VerifyCard(ctx, &CardVerificationRequest{CardNumber: card.Number, ExpireTime: expireTime, CVV: wrong})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardVerificationFailed().Error())
+
+	err = st.store.VerifyCard(ctx, &CardVerificationRequest{CardNumber: card.Number, ExpireTime: "01/20", CVV: card.CVV})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardVerificationFailed().Error())
+
+	// A success resets the failures, so the card isn't locked yet.
+	require.NoError(t, st.store.VerifyCard(ctx, &CardVerificationRequest{CardNumber: card.Number, ExpireTime: expireTime, CVV: card.CVV}))
+
+	for i := 0; i < maxCardVerificationFailures; i++ {
+		err = st.store.VerifyCard(ctx, &CardVerificationRequest{CardNumber: card.Number, ExpireTime: expireTime, CVV: wrong})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, CardVerificationFailed().Error())
+	}
+
+	err = st.store.VerifyCard(ctx, &CardVerificationRequest{CardNumber: card.Number, ExpireTime: expireTime, CVV: card.CVV})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardVerificationFailed().Error())
+
+	_, err = pool.Exec(ctx, `UPDATE cards SET verification_locked_until = NOW() WHERE id = $1`, card.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, st.store.VerifyCard(ctx, &CardVerificationRequest{CardNumber: card.Number, ExpireTime: expireTime, CVV: card.CVV}))
+
+	_, err = st.store.UpdateCardStatus(ctx, card.ID, []string{cardActive}, cardFrozen)
+	require.NoError(t, err)
+
+	err = st.store.VerifyCard(ctx, &CardVerificationRequest{CardNumber: card.Number, ExpireTime: expireTime, CVV: card.CVV})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, CardVerificationFailed().Error())
+}
+
+func TestPIIEncryption(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	newUser := fakeUser()
+
+	id, err := st.store.Register(ctx, newUser)
+	require.NoError(t, err)
+
+	pool := st.store.(*Storage).pool
+
+	var (
+		phoneNumber *string
+		sealedPhone []byte
+		cardNumber  *string
+	)
+	require.NoError(t, pool.QueryRow(ctx, `SELECT phone_number, phone_number_enc FROM users WHERE id = $1`, id).Scan(&phoneNumber, &sealedPhone))
+	assert.Nil(t, phoneNumber)
+	assert.NotContains(t, string(sealedPhone), newUser.PhoneNumber)
+
+	require.NoError(t, pool.QueryRow(ctx, `SELECT card_number FROM cards WHERE id = $1`, newUser.Accounts[0].Cards[0].ID).Scan(&cardNumber))
+	assert.Nil(t, cardNumber)
+
+	user, err := st.store.UserByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, newUser.FirstName, user.FirstName)
+	assert.Equal(t, newUser.PhoneNumber, user.PhoneNumber)
+	assert.Equal(t, newUser.Accounts[0].Cards[0].Number, user.Accounts[0].Cards[0].Number)
+
+	found, err := st.store.UserByPhoneNumber(ctx, newUser.PhoneNumber)
+	require.NoError(t, err)
+	assert.Equal(t, id, found.ID)
+
+	// Transactions reference the card instead of keeping its number.
+	deposit, err := st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: newUser.Accounts[0].Cards[0].Number,
+		Amount:       fakeAmount(),
+	})
+	require.NoError(t, err)
+
+	var toCardID *int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT to_card_number, to_card_id FROM transactions WHERE transaction_id = $1`, deposit.ID).Scan(&cardNumber, &toCardID))
+	assert.Nil(t, cardNumber)
+	require.NotNil(t, toCardID)
+	assert.Equal(t, newUser.Accounts[0].Cards[0].ID, *toCardID)
+
+	transactions, err := st.store.TransactionsByUser(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	assert.Equal(t, newUser.Accounts[0].Cards[0].Number, transactions[0].ToCardNumber)
+	assert.Empty(t, transactions[0].FromCardNumber)
+
+	// Rows written before encryption are sealed by Reencrypt.
+	legacy := fakeUser()
+	legacyCard := legacy.Accounts[0].Cards[0]
+
+	var legacyID, legacyAccountID, legacyCardID int
+	require.NoError(t, pool.QueryRow(ctx, `INSERT INTO users(first_name, last_name, phone_number, password_hash) VALUES($1, $2, $3, $4) RETURNING id`,
+		legacy.FirstName, legacy.LastName, legacy.PhoneNumber, legacy.PasswordHash).Scan(&legacyID))
+	require.NoError(t, pool.QueryRow(ctx, `INSERT INTO accounts(user_id) VALUES($1) RETURNING id`, legacyID).Scan(&legacyAccountID))
+	require.NoError(t, pool.QueryRow(ctx, `INSERT INTO cards(account_id, card_number, cvv_hash, expire_time, kind, status) VALUES($1, $2, '', $3, $4, $5) RETURNING id`,
+		legacyAccountID, legacyCard.Number, legacyCard.ExpireTime, legacyCard.Kind, legacyCard.Status).Scan(&legacyCardID))
+
+	var legacyTransactionID uuid.UUID
+	require.NoError(t, pool.QueryRow(ctx, `INSERT INTO transactions(transaction_type, amount, to_card_number, from_card_number, currency) VALUES($1, $2, $3, '', $4) RETURNING transaction_id`,
+		depositTransaction, fakeAmount(), legacyCard.Number, defaultCurrency).Scan(&legacyTransactionID))
+
+	_, err = st.store.UserByPhoneNumber(ctx, legacy.PhoneNumber)
+	require.Error(t, err)
+
+	n, err := st.store.(*Storage).Reencrypt(ctx, 10)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 2)
+
+	found, err = st.store.UserByPhoneNumber(ctx, legacy.PhoneNumber)
+	require.NoError(t, err)
+	assert.Equal(t, legacyID, found.ID)
+
+	user, err = st.store.UserByID(ctx, legacyID)
+	require.NoError(t, err)
+	assert.Equal(t, legacy.LastName, user.LastName)
+	require.Len(t, user.Accounts, 1)
+	assert.Equal(t, legacyCard.Number, user.Accounts[0].Cards[0].Number)
+
+	owner, err := st.store.CardOwner(ctx, legacyCard.Number)
+	require.NoError(t, err)
+	assert.Equal(t, legacyID, owner)
+
+	var (
+		fromCardNumber *string
+		fromCardID     *int
+	)
+	require.NoError(t, pool.QueryRow(ctx, `SELECT to_card_number, to_card_id, from_card_number, from_card_id FROM transactions WHERE transaction_id = $1`, legacyTransactionID).Scan(&cardNumber, &toCardID, &fromCardNumber, &fromCardID))
+	assert.Nil(t, cardNumber)
+	require.NotNil(t, toCardID)
+	assert.Equal(t, legacyCardID, *toCardID)
+	assert.Nil(t, fromCardNumber)
+	assert.Nil(t, fromCardID)
+}
+
+func TestCardTokens(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user1 := fakeUser()
+	user2 := fakeUser()
+
+	id1, err := st.store.Register(ctx, user1)
+	require.NoError(t, err)
+
+	_, err = st.store.Register(ctx, user2)
+	require.NoError(t, err)
+
+	card := user1.Accounts[0].Cards[0]
+	recipient := user2.Accounts[0].Cards[0]
+
+	token, err := st.store.TokenizeCard(ctx, card)
+	require.NoError(t, err)
+	assert.Equal(t, card.ID, token.CardID)
+	assert.NotEqual(t, card.Number, token.Token)
+	assert.Equal(t, card.Number[12:], token.Token[12:])
+
+	again, err := st.store.TokenizeCard(ctx, card)
+	require.NoError(t, err)
+	assert.Equal(t, token.Token, again.Token)
+
+	recipientToken, err := st.store.TokenizeCard(ctx, recipient)
+	require.NoError(t, err)
+
+	found, err := st.store.CardByToken(ctx, token.Token)
+	require.NoError(t, err)
+	assert.Equal(t, card.Number, found.Number)
+
+	_, err = st.store.Deposit(ctx, &TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: found.Number,
+		Amount:       1000,
+	})
+	require.NoError(t, err)
+
+	to, err := st.store.CardByToken(ctx, recipientToken.Token)
+	require.NoError(t, err)
+
+	_, err = st.store.Transfer(ctx, &TransactionRequest{
+		Type:           transferTransaction,
+		FromCardNumber: found.Number,
+		ToCardNumber:   to.Number,
+		FromCardToken:  token.Token,
+		ToCardToken:    recipientToken.Token,
+		Amount:         400,
+	})
+	require.NoError(t, err)
+
+	user, err := st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	assert.Equal(t, Money(600), user.Accounts[0].Balance)
+
+	_, err = st.store.TokenizeCard(ctx, Card{ID: -1, Number: card.Number})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, NoCard(-1).Error())
+
+	// Detokenization is recorded whether or not the token exists.
+	detokenized, err := st.store.Detokenize(ctx, &DetokenizeRequest{Token: token.Token, Reason: "chargeback investigation", UserID: id1})
+	require.NoError(t, err)
+	assert.Equal(t, card.Number, detokenized.Number)
+
+	_, err = st.store.Detokenize(ctx, &DetokenizeRequest{Token: "0000000000000000", Reason: "probe", UserID: id1})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, NoCardToken().Error())
+
+	entries, err := st.store.Detokenizations(ctx)
+	require.NoError(t, err)
+
+	var reasons []string
+	for _, d := range entries {
+		if d.UserID == id1 {
+			reasons = append(reasons, d.Reason)
+		}
+	}
+	assert.Equal(t, []string{"probe", "chargeback investigation"}, reasons)
+}
+
+func TestUserByPhoneNumber(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	newUser := fakeUser()
+
+	id, err := st.store.Register(ctx, newUser)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	user, err := st.store.UserByPhoneNumber(ctx, newUser.PhoneNumber)
+	require.NoError(t, err)
+	assert.Equal(t, newUser.PasswordHash, user.PasswordHash)
+
+	fakeUser, err := st.store.UserByPhoneNumber(ctx, "0000000000")
+	require.Error(t, err)
+	assert.Empty(t, fakeUser)
+	assert.ErrorContains(t, err, NoUser().Error())
+}
+
+func TestCardOwner(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	newUser := fakeUser()
+
+	id, err := st.store.Register(ctx, newUser)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	ownerID, err := st.store.CardOwner(ctx, newUser.Accounts[0].Cards[0].Number)
+	require.NoError(t, err)
+	assert.Equal(t, id, ownerID)
+
+	card := gofakeit.CreditCard()
+
+	ownerID, err = st.store.CardOwner(ctx, strconv.Itoa(card.Number))
+	require.Error(t, err)
+	assert.Empty(t, ownerID)
+	assert.ErrorContains(t, err, NoAccount(strconv.Itoa(card.Number)).Error())
+	assert.NotContains(t, err.Error(), strconv.Itoa(card.Number))
+}
+
+func TestTransactionsByUser(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	newUser1 := fakeUser()
+	newUser2 := fakeUser()
+
+	id1, err := st.store.Register(ctx, newUser1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id1)
+
+	id2, err := st.store.Register(ctx, newUser2)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id1)
+
+	user1, err := st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, user1)
+
+	user2, err := st.store.UserByID(ctx, id2)
+	require.NoError(t, err)
+	assert.NotEmpty(t, user2)
+
+	deposit := TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       fakeAmount(),
+	}
+
+	tr, err := st.store.Deposit(ctx, &deposit)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tr)
+
+	deposit = TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       fakeAmount(),
+	}
+
+	tr, err = st.store.Deposit(ctx, &deposit)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tr)
+
+	transfer := TransactionRequest{
+		Type:           transferTransaction,
+		FromCardNumber: user1.Accounts[0].Cards[0].Number,
+		ToCardNumber:   user2.Accounts[0].Cards[0].Number,
+		Amount:         1,
+	}
+
+	tr, err = st.store.Transfer(ctx, &transfer)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tr)
+
+	trs, err := st.store.TransactionsByUser(ctx, user1.ID)
+	require.NoError(t, err)
+	assert.Len(t, trs, 3)
+
+	fakeId := gofakeit.Uint8()
+
+	trs, err = st.store.TransactionsByUser(ctx, int(fakeId))
+	require.Error(t, err)
+	assert.Empty(t, trs)
+	assert.ErrorContains(t, err, NoUser().Error())
+}
+
+func TestInsertDepositTransaction(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	user := fakeUser()
+
+	id, err := st.store.Register(ctx, user)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	deposit := TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user.Accounts[0].Cards[0].Number,
+		Amount:       fakeAmount(),
+	}
+
+	tr, err := st.store.Deposit(ctx, &deposit)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tr)
+
+	now := time.Now().UTC()
+	delta := time.Second
+
+	assert.NotEmpty(t, tr.ID)
+	assert.Empty(t, tr.FromCardNumber)
+	assert.Equal(t, deposit.Amount, tr.Amount)
+	assert.Greater(t, tr.Amount, Money(0))
+	assert.Equal(t, user.Accounts[0].Cards[0].Number, tr.ToCardNumber)
+	assert.WithinDuration(t, now, tr.CreatedAt, delta)
+}
+
+func TestInsertTransferTransaction(t *testing.T) {
+	ctx, st := NewSuite(t)
+
+	newUser1 := fakeUser()
+	newUser2 := fakeUser()
+
+	id1, err := st.store.Register(ctx, newUser1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id1)
+
+	id2, err := st.store.Register(ctx, newUser2)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id2)
+
+	user1, err := st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, user1)
+
+	user2, err := st.store.UserByID(ctx, id2)
+	require.NoError(t, err)
+	assert.NotEmpty(t, user2)
+
+	deposit := TransactionRequest{
+		Type:         depositTransaction,
+		ToCardNumber: user1.Accounts[0].Cards[0].Number,
+		Amount:       fakeAmount(),
+	}
+
+	tr, err := st.store.Deposit(ctx, &deposit)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tr)
+
+	user1, err = st.store.UserByID(ctx, id1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, user2)
+
+	transfer := TransactionRequest{
+		Type:           transferTransaction,
+		FromCardNumber: user1.Accounts[0].Cards[0].Number,
+		ToCardNumber:   user2.Accounts[0].Cards[0].Number,
+		Amount:         user1.Accounts[0].Balance,
+	}
+
+	tr, err = st.store.Transfer(ctx, &transfer)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tr)
+
+	user1Trs, err := st.store.TransactionsByUser(ctx, user1.ID)
 	require.NoError(t, err)
 	assert.NotEmpty(t, user1Trs)
 
@@ -513,6 +2224,32 @@ func TestInsertTransferTransaction(t *testing.T) {
 	assert.Equal(t, transfer.Amount, user2Trs[0].Amount)
 }
 
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func fakeAmount() Money {
+	return Money(gofakeit.Number(int(minAmount), int(maxAmount)))
+}
+
+// wrongCheckDigit returns the number with its Luhn check digit changed.
+func wrongCheckDigit(number string) string {
+	last := number[len(number)-1]
+	return number[:len(number)-1] + string('0'+(last-'0'+1)%10)
+}
+
+// wrongCVV returns a CVV that differs from cvv.
+func wrongCVV(cvv string) string {
+	if cvv == "000" {
+		return "111"
+	}
+	return "000"
+}
+
 func fakeUser() *User {
 	firstName := gofakeit.Name()
 	lastName := gofakeit.LastName()
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	phoneIndex = "phone"
+	cardIndex  = "card"
+)
+
+// Keyring holds the key encryption keys PII is sealed with. Every row gets
+// its own data key, which is stored wrapped by the active key together with
+// the id of that key, so rotating only rewraps data keys.
+type Keyring struct {
+	keys     map[string][]byte
+	activeID string
+	indexKey []byte
+}
+
+func NewKeyring(keys map[string][]byte, activeID string, indexKey []byte) (*Keyring, error) {
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s should be 32 bytes, got %d", id, len(key))
+		}
+	}
+
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("active key %q is not configured", activeID)
+	}
+
+	if len(indexKey) == 0 {
+		return nil, fmt.Errorf("index key is not configured")
+	}
+
+	return &Keyring{
+		keys:     keys,
+		activeID: activeID,
+		indexKey: indexKey,
+	}, nil
+}
+
+// ParseKeyring builds a keyring from a comma-separated list of id:key pairs
+// with base64 keys, the id of the key new rows are sealed with and the base64
+// key of the blind index.
+func ParseKeyring(keys, activeID, indexKey string) (*Keyring, error) {
+	parsed := make(map[string][]byte)
+
+	for _, pair := range strings.Split(keys, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("malformed key %q: should be id:base64", pair)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("malformed key %s: %s", id, err)
+		}
+
+		parsed[id] = key
+	}
+
+	index, err := base64.StdEncoding.DecodeString(indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("malformed index key: %s", err)
+	}
+
+	return NewKeyring(parsed, activeID, index)
+}
+
+// ActiveID returns the id of the key new data keys are wrapped with.
+func (k *Keyring) ActiveID() string {
+	return k.activeID
+}
+
+// Seal encrypts the fields of one row under a fresh data key and returns the
+// id of the key wrapping it, the wrapped data key and the sealed fields in
+// order.
+func (k *Keyring) Seal(fields ...string) (string, []byte, [][]byte, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", nil, nil, err
+	}
+
+	wrapped, err := seal(k.keys[k.activeID], dek, []byte(k.activeID))
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	sealed := make([][]byte, len(fields))
+	for i, f := range fields {
+		if sealed[i], err = seal(dek, []byte(f), []byte{byte(i)}); err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	return k.activeID, wrapped, sealed, nil
+}
+
+// Open decrypts fields sealed by Seal. The fields must be passed in the order
+// they were sealed.
+func (k *Keyring) Open(keyID string, wrapped []byte, sealed ...[]byte) ([]string, error) {
+	dek, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, len(sealed))
+	for i, s := range sealed {
+		f, err := open(dek, s, []byte{byte(i)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open field %d: %s", i, err)
+		}
+		fields[i] = string(f)
+	}
+
+	return fields, nil
+}
+
+// Rewrap wraps a data key with the active key, leaving the fields it seals
+// untouched.
+func (k *Keyring) Rewrap(keyID string, wrapped []byte) (string, []byte, error) {
+	dek, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return "", nil, err
+	}
+
+	rewrapped, err := seal(k.keys[k.activeID], dek, []byte(k.activeID))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return k.activeID, rewrapped, nil
+}
+
+// Index returns the blind index of a value: a keyed hash that allows exact
+// lookups and uniqueness checks without storing the value.
+func (k *Keyring) Index(kind, value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(kind + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (k *Keyring) unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	kek, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %q is not configured", keyID)
+	}
+
+	dek, err := open(kek, wrapped, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %s", err)
+	}
+
+	return dek, nil
+}
+
+// seal encrypts with AES-GCM and prefixes the ciphertext with its nonce.
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(key, ciphertext, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+
+	return gcm.Open(nil, nonce, ciphertext, additional)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyring_SealOpen(t *testing.T) {
+	keys := testKeyring(t, "k1")
+
+	keyID, wrapped, sealed, err := keys.Seal("John", "Smith", "9876543210")
+	require.NoError(t, err)
+	assert.Equal(t, "k1", keyID)
+	require.Len(t, sealed, 3)
+	assert.NotContains(t, string(sealed[2]), "9876543210")
+
+	fields, err := keys.Open(keyID, wrapped, sealed...)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"John", "Smith", "9876543210"}, fields)
+
+	_, err = keys.Open(keyID, wrapped, sealed[1], sealed[0])
+	assert.Error(t, err)
+
+	_, err = keys.Open("k2", wrapped, sealed...)
+	assert.Error(t, err)
+}
+
+func TestKeyring_Rewrap(t *testing.T) {
+	old := testKeyring(t, "k1")
+
+	keyID, wrapped, sealed, err := old.Seal("4000001234567899")
+	require.NoError(t, err)
+
+	rotated, err := NewKeyring(map[string][]byte{
+		"k1": old.keys["k1"],
+		"k2": bytes.Repeat([]byte{2}, 32),
+	}, "k2", old.indexKey)
+	require.NoError(t, err)
+
+	newID, rewrapped, err := rotated.Rewrap(keyID, wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, "k2", newID)
+
+	fields, err := rotated.Open(newID, rewrapped, sealed...)
+	require.NoError(t, err)
+	assert.Equal(t, "4000001234567899", fields[0])
+
+	assert.Equal(t, old.Index(cardIndex, "4000001234567899"), rotated.Index(cardIndex, "4000001234567899"))
+	assert.NotEqual(t, rotated.Index(cardIndex, "4000001234567899"), rotated.Index(phoneIndex, "4000001234567899"))
+}
+
+func TestParseKeyring(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	index := base64.StdEncoding.EncodeToString([]byte("index"))
+
+	keys, err := ParseKeyring("k1:"+key+", k2:"+key, "k2", index)
+	require.NoError(t, err)
+	assert.Equal(t, "k2", keys.ActiveID())
+
+	_, err = ParseKeyring("k1:"+key, "k2", index)
+	assert.Error(t, err)
+
+	_, err = ParseKeyring("k1:"+base64.StdEncoding.EncodeToString([]byte("short")), "k1", index)
+	assert.Error(t, err)
+
+	_, err = ParseKeyring("k1", "k1", index)
+	assert.Error(t, err)
+
+	_, err = ParseKeyring("k1:"+key, "k1", "")
+	assert.Error(t, err)
+}
+
+func testKeyring(t *testing.T, activeID string) *Keyring {
+	keys, err := NewKeyring(map[string][]byte{activeID: bytes.Repeat([]byte{1}, 32)}, activeID, []byte("index"))
+	require.NoError(t, err)
+	return keys
+}
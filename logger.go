@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
@@ -80,6 +81,396 @@ func (l *Logger) Transfer(ctx context.Context, transfer *TransactionRequest) (tr
 	return l.next.Transfer(ctx, transfer)
 }
 
+func (l *Logger) Withdraw(ctx context.Context, withdrawal *TransactionRequest) (transaction Transaction, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+			}).Info("withdrawal")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("withdrawal failed")
+		}
+	}(time.Now())
+
+	return l.next.Withdraw(ctx, withdrawal)
+}
+
+func (l *Logger) Reverse(ctx context.Context, reversal *ReversalRequest) (transaction Transaction, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":           fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":     ctx.Value(RequestID{}),
+				"transaction_id": reversal.TransactionID,
+			}).Info("reversal")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id":     ctx.Value(RequestID{}),
+				"error":          err,
+				"transaction_id": reversal.TransactionID,
+			}).Error("reversal failed")
+		}
+	}(time.Now())
+
+	return l.next.Reverse(ctx, reversal)
+}
+
+func (l *Logger) PlaceHold(ctx context.Context, req *HoldRequest) (hold Hold, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+			}).Info("place hold")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("place hold failed")
+		}
+	}(time.Now())
+
+	return l.next.PlaceHold(ctx, req)
+}
+
+func (l *Logger) HoldByID(ctx context.Context, id uuid.UUID) (hold Hold, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"hold_id":    id,
+			}).Info("get hold")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"hold_id":    id,
+			}).Error("get hold failed")
+		}
+	}(time.Now())
+
+	return l.next.HoldByID(ctx, id)
+}
+
+func (l *Logger) CaptureHold(ctx context.Context, capture *CaptureRequest) (transaction Transaction, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"hold_id":    capture.HoldID,
+			}).Info("capture hold")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"hold_id":    capture.HoldID,
+			}).Error("capture hold failed")
+		}
+	}(time.Now())
+
+	return l.next.CaptureHold(ctx, capture)
+}
+
+func (l *Logger) ReleaseHold(ctx context.Context, id uuid.UUID) (hold Hold, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"hold_id":    id,
+			}).Info("release hold")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"hold_id":    id,
+			}).Error("release hold failed")
+		}
+	}(time.Now())
+
+	return l.next.ReleaseHold(ctx, id)
+}
+
+func (l *Logger) ExpireHolds(ctx context.Context) (expired int, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+			}).Info("expire holds")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("expire holds failed")
+		}
+	}(time.Now())
+
+	return l.next.ExpireHolds(ctx)
+}
+
+func (l *Logger) ScheduleTransfer(ctx context.Context, transfer *TransactionRequest) (scheduled ScheduledTransfer, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+			}).Info("schedule transfer")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("schedule transfer failed")
+		}
+	}(time.Now())
+
+	return l.next.ScheduleTransfer(ctx, transfer)
+}
+
+func (l *Logger) ScheduledTransferByID(ctx context.Context, id uuid.UUID) (scheduled ScheduledTransfer, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":                  fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":            ctx.Value(RequestID{}),
+				"scheduled_transfer_id": id,
+			}).Info("get scheduled transfer")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id":            ctx.Value(RequestID{}),
+				"error":                 err,
+				"scheduled_transfer_id": id,
+			}).Error("get scheduled transfer failed")
+		}
+	}(time.Now())
+
+	return l.next.ScheduledTransferByID(ctx, id)
+}
+
+func (l *Logger) CancelScheduledTransfer(ctx context.Context, id uuid.UUID) (scheduled ScheduledTransfer, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":                  fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":            ctx.Value(RequestID{}),
+				"scheduled_transfer_id": id,
+			}).Info("cancel scheduled transfer")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id":            ctx.Value(RequestID{}),
+				"error":                 err,
+				"scheduled_transfer_id": id,
+			}).Error("cancel scheduled transfer failed")
+		}
+	}(time.Now())
+
+	return l.next.CancelScheduledTransfer(ctx, id)
+}
+
+func (l *Logger) ClaimDueScheduledTransfers(ctx context.Context, limit int) (transfers []ScheduledTransfer, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+			}).Info("claim scheduled transfers")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("claim scheduled transfers failed")
+		}
+	}(time.Now())
+
+	return l.next.ClaimDueScheduledTransfers(ctx, limit)
+}
+
+func (l *Logger) FinishScheduledTransfer(ctx context.Context, scheduled *ScheduledTransfer) (err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":                  fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":            ctx.Value(RequestID{}),
+				"scheduled_transfer_id": scheduled.ID,
+				"status":                scheduled.Status,
+			}).Info("finish scheduled transfer")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id":            ctx.Value(RequestID{}),
+				"error":                 err,
+				"scheduled_transfer_id": scheduled.ID,
+				"status":                scheduled.Status,
+			}).Error("finish scheduled transfer failed")
+		}
+	}(time.Now())
+
+	return l.next.FinishScheduledTransfer(ctx, scheduled)
+}
+
+func (l *Logger) CreateStandingOrder(ctx context.Context, order *StandingOrder) (err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+			}).Info("create standing order")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("create standing order failed")
+		}
+	}(time.Now())
+
+	return l.next.CreateStandingOrder(ctx, order)
+}
+
+func (l *Logger) StandingOrderByID(ctx context.Context, id uuid.UUID) (order StandingOrder, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":              fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":        ctx.Value(RequestID{}),
+				"standing_order_id": id,
+			}).Info("get standing order")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id":        ctx.Value(RequestID{}),
+				"error":             err,
+				"standing_order_id": id,
+			}).Error("get standing order failed")
+		}
+	}(time.Now())
+
+	return l.next.StandingOrderByID(ctx, id)
+}
+
+func (l *Logger) StandingOrdersByUser(ctx context.Context, id int) (orders []StandingOrder, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"user ID":    id,
+			}).Info("get standing orders by user")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"user ID":    id,
+			}).Error("get standing orders by user failed")
+		}
+	}(time.Now())
+
+	return l.next.StandingOrdersByUser(ctx, id)
+}
+
+func (l *Logger) UpdateStandingOrder(ctx context.Context, update *StandingOrderUpdate) (order StandingOrder, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":              fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":        ctx.Value(RequestID{}),
+				"standing_order_id": update.ID,
+			}).Info("update standing order")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id":        ctx.Value(RequestID{}),
+				"error":             err,
+				"standing_order_id": update.ID,
+			}).Error("update standing order failed")
+		}
+	}(time.Now())
+
+	return l.next.UpdateStandingOrder(ctx, update)
+}
+
+func (l *Logger) CancelStandingOrder(ctx context.Context, id uuid.UUID) (order StandingOrder, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":              fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":        ctx.Value(RequestID{}),
+				"standing_order_id": id,
+			}).Info("cancel standing order")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id":        ctx.Value(RequestID{}),
+				"error":             err,
+				"standing_order_id": id,
+			}).Error("cancel standing order failed")
+		}
+	}(time.Now())
+
+	return l.next.CancelStandingOrder(ctx, id)
+}
+
+func (l *Logger) ClaimDueStandingOrders(ctx context.Context, limit int) (orders []StandingOrder, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+			}).Info("claim standing orders")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("claim standing orders failed")
+		}
+	}(time.Now())
+
+	return l.next.ClaimDueStandingOrders(ctx, limit)
+}
+
+func (l *Logger) RecordStandingOrderRun(ctx context.Context, order *StandingOrder, run *StandingOrderRun) (err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":              fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":        ctx.Value(RequestID{}),
+				"standing_order_id": order.ID,
+				"status":            run.Status,
+			}).Info("record standing order run")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id":        ctx.Value(RequestID{}),
+				"error":             err,
+				"standing_order_id": order.ID,
+				"status":            run.Status,
+			}).Error("record standing order run failed")
+		}
+	}(time.Now())
+
+	return l.next.RecordStandingOrderRun(ctx, order, run)
+}
+
+func (l *Logger) StandingOrderRuns(ctx context.Context, id uuid.UUID) (runs []StandingOrderRun, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":              fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":        ctx.Value(RequestID{}),
+				"standing_order_id": id,
+			}).Info("get standing order runs")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id":        ctx.Value(RequestID{}),
+				"error":             err,
+				"standing_order_id": id,
+			}).Error("get standing order runs failed")
+		}
+	}(time.Now())
+
+	return l.next.StandingOrderRuns(ctx, id)
+}
+
 func (l *Logger) UserByID(ctx context.Context, id int) (user User, err error) {
 	defer func(begin time.Time) {
 		if err == nil {
@@ -99,6 +490,570 @@ func (l *Logger) UserByID(ctx context.Context, id int) (user User, err error) {
 	return l.next.UserByID(ctx, id)
 }
 
+func (l *Logger) OpenAccount(ctx context.Context, userID int, account *Account) (err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":         fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":   ctx.Value(RequestID{}),
+				"user ID":      userID,
+				"account_type": account.Type,
+			}).Info("open account")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id":   ctx.Value(RequestID{}),
+				"error":        err,
+				"user ID":      userID,
+				"account_type": account.Type,
+			}).Error("open account failed")
+		}
+	}(time.Now())
+
+	return l.next.OpenAccount(ctx, userID, account)
+}
+
+func (l *Logger) AccountByID(ctx context.Context, id int) (account Account, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"account ID": id,
+			}).Info("get account")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"account ID": id,
+			}).Error("get account failed")
+		}
+	}(time.Now())
+
+	return l.next.AccountByID(ctx, id)
+}
+
+func (l *Logger) IssueCard(ctx context.Context, accountID int, card *Card) (err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"account ID": accountID,
+				"kind":       card.Kind,
+			}).Info("issue card")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"account ID": accountID,
+				"kind":       card.Kind,
+			}).Error("issue card failed")
+		}
+	}(time.Now())
+
+	return l.next.IssueCard(ctx, accountID, card)
+}
+
+func (l *Logger) CardsByAccount(ctx context.Context, accountID int) (cards []Card, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"account ID": accountID,
+			}).Info("get cards")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"account ID": accountID,
+			}).Error("get cards failed")
+		}
+	}(time.Now())
+
+	return l.next.CardsByAccount(ctx, accountID)
+}
+
+func (l *Logger) CardByID(ctx context.Context, id int) (card Card, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"card ID":    id,
+			}).Info("get card")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"card ID":    id,
+			}).Error("get card failed")
+		}
+	}(time.Now())
+
+	return l.next.CardByID(ctx, id)
+}
+
+func (l *Logger) UpdateCardStatus(ctx context.Context, id int, from []string, status string) (card Card, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"card ID":    id,
+				"status":     status,
+			}).Info("update card status")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"card ID":    id,
+				"status":     status,
+			}).Error("update card status failed")
+		}
+	}(time.Now())
+
+	return l.next.UpdateCardStatus(ctx, id, from, status)
+}
+
+func (l *Logger) ReplaceCard(ctx context.Context, id int, replacement *Card) (err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"card ID":    id,
+			}).Info("replace card")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"card ID":    id,
+			}).Error("replace card failed")
+		}
+	}(time.Now())
+
+	return l.next.ReplaceCard(ctx, id, replacement)
+}
+
+func (l *Logger) ActivateCard(ctx context.Context, card *Card) (err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"card ID":    card.ID,
+			}).Info("activate card")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"card ID":    card.ID,
+			}).Error("activate card failed")
+		}
+	}(time.Now())
+
+	return l.next.ActivateCard(ctx, card)
+}
+
+func (l *Logger) ExpiringCards(ctx context.Context, before time.Time, limit int) (cards []Card, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"cards":      len(cards),
+			}).Info("get expiring cards")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("get expiring cards failed")
+		}
+	}(time.Now())
+
+	return l.next.ExpiringCards(ctx, before, limit)
+}
+
+func (l *Logger) ReissueCard(ctx context.Context, id int, replacement *Card) (err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"card ID":    id,
+			}).Info("reissue card")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"card ID":    id,
+			}).Error("reissue card failed")
+		}
+	}(time.Now())
+
+	return l.next.ReissueCard(ctx, id, replacement)
+}
+
+func (l *Logger) NotificationsByUser(ctx context.Context, userID int) (notifications []Notification, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"user ID":    userID,
+			}).Info("get notifications")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"user ID":    userID,
+			}).Error("get notifications failed")
+		}
+	}(time.Now())
+
+	return l.next.NotificationsByUser(ctx, userID)
+}
+
+func (l *Logger) VerifyCard(ctx context.Context, req *CardVerificationRequest) (err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"card":       maskDigits(req.CardNumber),
+			}).Info("verify card")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"card":       maskDigits(req.CardNumber),
+			}).Error("verify card failed")
+		}
+	}(time.Now())
+
+	return l.next.VerifyCard(ctx, req)
+}
+
+func (l *Logger) TokenizeCard(ctx context.Context, card Card) (token CardToken, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"card ID":    card.ID,
+			}).Info("tokenize card")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"card ID":    card.ID,
+			}).Error("tokenize card failed")
+		}
+	}(time.Now())
+
+	return l.next.TokenizeCard(ctx, card)
+}
+
+func (l *Logger) CardByToken(ctx context.Context, token string) (card Card, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"card ID":    card.ID,
+			}).Info("get card by token")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("get card by token failed")
+		}
+	}(time.Now())
+
+	return l.next.CardByToken(ctx, token)
+}
+
+// Detokenize is logged as an audit event on top of the detokenization log
+// the store keeps.
+func (l *Logger) Detokenize(ctx context.Context, req *DetokenizeRequest) (card Card, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"audit":      true,
+				"user ID":    req.UserID,
+				"card ID":    card.ID,
+				"reason":     req.Reason,
+			}).Info("detokenize card")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"audit":      true,
+				"error":      err,
+				"user ID":    req.UserID,
+				"reason":     req.Reason,
+			}).Error("detokenize card failed")
+		}
+	}(time.Now())
+
+	return l.next.Detokenize(ctx, req)
+}
+
+func (l *Logger) Detokenizations(ctx context.Context) (detokenizations []Detokenization, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":            fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":      ctx.Value(RequestID{}),
+				"detokenizations": len(detokenizations),
+			}).Info("get detokenizations")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("get detokenizations failed")
+		}
+	}(time.Now())
+
+	return l.next.Detokenizations(ctx)
+}
+
+func (l *Logger) LimitsByAccount(ctx context.Context, id int) (limits AccountLimits, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"account ID": id,
+			}).Info("get limits")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"account ID": id,
+			}).Error("get limits failed")
+		}
+	}(time.Now())
+
+	return l.next.LimitsByAccount(ctx, id)
+}
+
+func (l *Logger) UpdateLimits(ctx context.Context, id int, update *AccountLimits) (limits AccountLimits, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"account ID": id,
+			}).Info("update limits")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"account ID": id,
+			}).Error("update limits failed")
+		}
+	}(time.Now())
+
+	return l.next.UpdateLimits(ctx, id, update)
+}
+
+func (l *Logger) SetOverdraft(ctx context.Context, id int, limit Money) (account Account, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"account ID": id,
+			}).Info("set overdraft")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"account ID": id,
+			}).Error("set overdraft failed")
+		}
+	}(time.Now())
+
+	return l.next.SetOverdraft(ctx, id, limit)
+}
+
+func (l *Logger) InterestRates(ctx context.Context) (rates []InterestRate, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+			}).Info("get interest rates")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("get interest rates failed")
+		}
+	}(time.Now())
+
+	return l.next.InterestRates(ctx)
+}
+
+func (l *Logger) SetInterestRate(ctx context.Context, update *InterestRate) (rate InterestRate, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":         fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":   ctx.Value(RequestID{}),
+				"account_type": update.AccountType,
+			}).Info("set interest rate")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id":   ctx.Value(RequestID{}),
+				"error":        err,
+				"account_type": update.AccountType,
+			}).Error("set interest rate failed")
+		}
+	}(time.Now())
+
+	return l.next.SetInterestRate(ctx, update)
+}
+
+func (l *Logger) ExchangeRates(ctx context.Context) (rates []ExchangeRate, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+			}).Info("get exchange rates")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("get exchange rates failed")
+		}
+	}(time.Now())
+
+	return l.next.ExchangeRates(ctx)
+}
+
+func (l *Logger) SetExchangeRate(ctx context.Context, update *ExchangeRate) (rate ExchangeRate, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"base":       update.Base,
+				"quote":      update.Quote,
+				"rate":       update.Rate,
+			}).Info("set exchange rate")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"base":       update.Base,
+				"quote":      update.Quote,
+			}).Error("set exchange rate failed")
+		}
+	}(time.Now())
+
+	return l.next.SetExchangeRate(ctx, update)
+}
+
+func (l *Logger) AccrueInterest(ctx context.Context, through time.Time) (err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+				"through":    through.Format(time.DateOnly),
+			}).Info("accrue interest")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"through":    through.Format(time.DateOnly),
+			}).Error("accrue interest failed")
+		}
+	}(time.Now())
+
+	return l.next.AccrueInterest(ctx, through)
+}
+
+func (l *Logger) CapitalizeInterest(ctx context.Context, before time.Time) (n int, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":         fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id":   ctx.Value(RequestID{}),
+				"before":       before.Format(time.DateOnly),
+				"transactions": n,
+			}).Info("capitalize interest")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+				"before":     before.Format(time.DateOnly),
+			}).Error("capitalize interest failed")
+		}
+	}(time.Now())
+
+	return l.next.CapitalizeInterest(ctx, before)
+}
+
+func (l *Logger) UserByPhoneNumber(ctx context.Context, phoneNumber string) (user User, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+			}).Info("get user by phone number")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("get user by phone number failed")
+		}
+	}(time.Now())
+
+	return l.next.UserByPhoneNumber(ctx, phoneNumber)
+}
+
+func (l *Logger) CardOwner(ctx context.Context, cardNumber string) (userID int, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+			}).Info("get card owner")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("get card owner failed")
+		}
+	}(time.Now())
+
+	return l.next.CardOwner(ctx, cardNumber)
+}
+
+func (l *Logger) CardExists(ctx context.Context, cardNumber string) (exists bool, err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			l.log.WithFields(logrus.Fields{
+				"took":       fmt.Sprintf("%dµs", time.Since(begin).Microseconds()),
+				"request_id": ctx.Value(RequestID{}),
+			}).Info("check card exists")
+		} else {
+			l.log.WithFields(logrus.Fields{
+				"request_id": ctx.Value(RequestID{}),
+				"error":      err,
+			}).Error("check card exists failed")
+		}
+	}(time.Now())
+
+	return l.next.CardExists(ctx, cardNumber)
+}
+
 func (l *Logger) TransactionsByUser(ctx context.Context, id int) (transactions []Transaction, err error) {
 	defer func(begin time.Time) {
 		if err == nil {
@@ -0,0 +1,35 @@
+package main
+
+// luhnCheckDigit returns the digit that makes payload followed by it pass
+// the Luhn check. The payload must contain only digits.
+func luhnCheckDigit(payload string) byte {
+	sum := 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		d := int(payload[i] - '0')
+		if (len(payload)-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+// luhnValid reports whether the number is all digits and its last digit is
+// the Luhn check digit of the rest.
+func luhnValid(number string) bool {
+	if len(number) < 2 {
+		return false
+	}
+
+	for i := 0; i < len(number); i++ {
+		if number[i] < '0' || number[i] > '9' {
+			return false
+		}
+	}
+
+	return luhnCheckDigit(number[:len(number)-1]) == number[len(number)-1]
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLuhnValid(t *testing.T) {
+	tests := []struct {
+		number string
+		valid  bool
+	}{
+		{"4111111111111111", true},
+		{"5500000000000004", true},
+		{"79927398713", true},
+		{"4111111111111112", false},
+		{"1234567812345678", false},
+		{"41111111111111a1", false},
+		{"0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			assert.Equal(t, tt.valid, luhnValid(tt.number))
+		})
+	}
+}
+
+func TestSetCardBIN(t *testing.T) {
+	defer func() { cardBIN = defaultCardBIN }()
+
+	assert.Error(t, SetCardBIN("12345"))
+	assert.Error(t, SetCardBIN("123456789"))
+	assert.Error(t, SetCardBIN("52a456"))
+	assert.Equal(t, defaultCardBIN, cardBIN)
+
+	assert.NoError(t, SetCardBIN("52345678"))
+	card := NewCard()
+	assert.Equal(t, "52345678", card.Number[:8])
+	assert.True(t, luhnValid(card.Number))
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
+const reencryptBatchSize = 500
+
 func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("failed to load env file", err)
@@ -17,19 +20,104 @@ func main() {
 	var (
 		listenAddr = os.Getenv("LISTEN_ADDR")
 		connStr    = os.Getenv("DATABASE_URL")
+		authSecret = os.Getenv("AUTH_SECRET")
+		cvvSecret  = os.Getenv("CVV_SECRET")
 	)
 
+	if authSecret == "" {
+		log.Fatal("AUTH_SECRET is not set")
+	}
+
+	if cvvSecret == "" {
+		log.Fatal("CVV_SECRET is not set")
+	}
+
+	keys, err := ParseKeyring(os.Getenv("PII_KEYS"), os.Getenv("PII_ACTIVE_KEY"), os.Getenv("PII_INDEX_KEY"))
+	if err != nil {
+		log.Fatal("invalid PII keys: ", err)
+	}
+
+	if bin := os.Getenv("CARD_BIN"); bin != "" {
+		if err := SetCardBIN(bin); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	accessTTL := envDuration("ACCESS_TOKEN_TTL")
+	if accessTTL == 0 {
+		accessTTL = time.Minute * 15
+	}
+
+	refreshTTL := envDuration("REFRESH_TOKEN_TTL")
+	if refreshTTL == 0 {
+		refreshTTL = time.Hour * 24 * 7
+	}
+
+	poolCfg := PoolConfig{
+		MinConns:          int32(envInt("DB_MIN_CONNS")),
+		MaxConns:          int32(envInt("DB_MAX_CONNS")),
+		MaxConnLifetime:   envDuration("DB_MAX_CONN_LIFETIME"),
+		MaxConnIdleTime:   envDuration("DB_MAX_CONN_IDLE_TIME"),
+		HealthCheckPeriod: envDuration("DB_HEALTH_CHECK_PERIOD"),
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	store, err := NewStorage(ctx, connStr)
+	store, err := NewStorage(ctx, connStr, poolCfg, cvvSecret, keys)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer store.Close(ctx)
+	defer store.Close()
+
+	if len(os.Args) > 1 && os.Args[1] == "reencrypt" {
+		reencrypt(store)
+		return
+	}
 
 	logger := NewLogger(store)
 
-	srv := NewServer(listenAddr, logger)
+	tokens := NewTokenManager(authSecret, accessTTL, refreshTTL)
+
+	srv := NewServer(listenAddr, logger, tokens)
 	srv.Run(ctx)
 }
+
+// reencrypt seals leftover plaintext PII and moves every data key onto the
+// active key, so retired keys can be removed from PII_KEYS afterwards.
+func reencrypt(store *Storage) {
+	n, err := store.Reencrypt(context.Background(), reencryptBatchSize)
+	if err != nil {
+		log.Fatalf("reencrypt failed after %d rows: %s", n, err)
+	}
+
+	log.Printf("reencrypted %d rows", n)
+}
+
+func envInt(key string) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %s", key, err)
+	}
+
+	return n
+}
+
+func envDuration(key string) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %s", key, err)
+	}
+
+	return d
+}
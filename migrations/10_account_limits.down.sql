@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_postings_account_id_created_at;
+
+ALTER TABLE accounts DROP COLUMN IF EXISTS daily_count_limit;
+ALTER TABLE accounts DROP COLUMN IF EXISTS daily_limit;
+ALTER TABLE accounts DROP COLUMN IF EXISTS transaction_limit;
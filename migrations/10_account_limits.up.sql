@@ -0,0 +1,5 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS transaction_limit BIGINT NOT NULL DEFAULT 1000000 CHECK (transaction_limit > 0);
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS daily_limit BIGINT NOT NULL DEFAULT 5000000 CHECK (daily_limit > 0);
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS daily_count_limit INT NOT NULL DEFAULT 50 CHECK (daily_count_limit > 0);
+
+CREATE INDEX IF NOT EXISTS idx_postings_account_id_created_at ON postings(account_id, created_at);
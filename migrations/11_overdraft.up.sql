@@ -0,0 +1,4 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS overdraft_limit BIGINT NOT NULL DEFAULT 0 CHECK (overdraft_limit >= 0);
+
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_balance_check;
+ALTER TABLE accounts ADD CONSTRAINT accounts_balance_check CHECK (balance >= -overdraft_limit);
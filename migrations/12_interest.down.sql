@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS interest_accruals;
+
+UPDATE accounts SET balance = balance - (
+	SELECT COALESCE(SUM(postings.amount), 0)
+	FROM postings
+	JOIN transactions ON postings.transaction_id = transactions.transaction_id
+	WHERE postings.account_id = accounts.id AND transactions.transaction_type = 'interest'
+)
+WHERE system_name IS NULL;
+
+DELETE FROM transactions WHERE transaction_type = 'interest';
+DELETE FROM accounts WHERE system_name = 'interest';
+
+ALTER TABLE accounts DROP COLUMN IF EXISTS accrued_through;
+ALTER TABLE accounts DROP COLUMN IF EXISTS account_type;
+
+DROP TABLE IF EXISTS interest_rates;
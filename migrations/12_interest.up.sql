@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS interest_rates (
+	account_type VARCHAR(20) PRIMARY KEY,
+	annual_rate_bps INT NOT NULL DEFAULT 0 CHECK (annual_rate_bps >= 0)
+);
+
+INSERT INTO interest_rates(account_type, annual_rate_bps) VALUES('checking', 0), ('savings', 250);
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS account_type VARCHAR(20) NOT NULL DEFAULT 'checking' REFERENCES interest_rates(account_type);
+
+-- Last day whose end-of-day balance has been accrued. New accounts start
+-- accruing on the day they are opened.
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS accrued_through DATE NOT NULL DEFAULT ((NOW() AT TIME ZONE 'UTC')::DATE - 1);
+
+INSERT INTO accounts(user_id, balance, system_name) VALUES(NULL, 0, 'interest');
+
+-- Daily interest in fractional minor units. Accruals are capitalized once a
+-- month into a single interest transaction.
+CREATE TABLE IF NOT EXISTS interest_accruals (
+	account_id INT NOT NULL,
+	accrual_date DATE NOT NULL,
+	balance BIGINT NOT NULL,
+	annual_rate_bps INT NOT NULL,
+	amount NUMERIC(20,6) NOT NULL,
+	transaction_id UUID,
+	PRIMARY KEY (account_id, accrual_date),
+	FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE,
+	FOREIGN KEY (transaction_id) REFERENCES transactions(transaction_id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_interest_accruals_uncapitalized ON interest_accruals(account_id) WHERE transaction_id IS NULL;
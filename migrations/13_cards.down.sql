@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_cards_account_id;
+
+ALTER TABLE cards DROP COLUMN IF EXISTS created_at;
+ALTER TABLE cards DROP COLUMN IF EXISTS status;
+ALTER TABLE cards DROP COLUMN IF EXISTS kind;
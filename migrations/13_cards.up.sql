@@ -0,0 +1,5 @@
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS kind VARCHAR(10) NOT NULL DEFAULT 'physical' CHECK (kind IN ('physical', 'virtual'));
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS status VARCHAR(10) NOT NULL DEFAULT 'active';
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_cards_account_id ON cards(account_id);
@@ -0,0 +1,2 @@
+ALTER TABLE cards DROP COLUMN IF EXISTS replaced_by;
+ALTER TABLE cards DROP CONSTRAINT IF EXISTS cards_status_check;
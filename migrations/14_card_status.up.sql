@@ -0,0 +1,2 @@
+ALTER TABLE cards ADD CONSTRAINT cards_status_check CHECK (status IN ('active', 'frozen', 'blocked'));
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS replaced_by INT REFERENCES cards(id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS notifications;
+
+DROP INDEX IF EXISTS idx_cards_expiring;
+
+ALTER TABLE cards ALTER COLUMN expire_time TYPE VARCHAR(5) USING to_char(expire_time, 'MM/YY');
@@ -0,0 +1,15 @@
+-- Cards are valid through the last day of their MM/YY expiry month.
+ALTER TABLE cards ALTER COLUMN expire_time TYPE DATE
+	USING (to_date(expire_time, 'MM/YY') + INTERVAL '1 month' - INTERVAL '1 day')::DATE;
+
+CREATE INDEX IF NOT EXISTS idx_cards_expiring ON cards(expire_time) WHERE status = 'active' AND replaced_by IS NULL;
+
+CREATE TABLE IF NOT EXISTS notifications (
+	id BIGSERIAL PRIMARY KEY,
+	user_id INT NOT NULL,
+	message TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT NOW(),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_notifications_user_id ON notifications(user_id);
@@ -0,0 +1,5 @@
+ALTER TABLE cards DROP COLUMN cvv_hash;
+
+ALTER TABLE cards ADD COLUMN cvv VARCHAR(3) NOT NULL DEFAULT '000' CHECK (LENGTH(cvv) = 3);
+
+ALTER TABLE cards ALTER COLUMN cvv DROP DEFAULT;
@@ -0,0 +1,8 @@
+-- CVVs are kept only as a keyed hash. Existing values can't be hashed without
+-- the application key, so they are discarded and those cards fail card-present
+-- verification until they are replaced.
+ALTER TABLE cards DROP COLUMN cvv;
+
+ALTER TABLE cards ADD COLUMN cvv_hash TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE cards ALTER COLUMN cvv_hash DROP DEFAULT;
@@ -0,0 +1,23 @@
+-- Rows sealed by the application have no plaintext to fall back to, so this
+-- fails on them until they are decrypted.
+DROP INDEX IF EXISTS idx_cards_key_id;
+
+DROP INDEX IF EXISTS idx_users_key_id;
+
+ALTER TABLE cards
+	ALTER COLUMN card_number SET NOT NULL,
+	DROP COLUMN card_number_index,
+	DROP COLUMN card_number_enc,
+	DROP COLUMN dek,
+	DROP COLUMN key_id;
+
+ALTER TABLE users
+	ALTER COLUMN phone_number SET NOT NULL,
+	ALTER COLUMN last_name SET NOT NULL,
+	ALTER COLUMN first_name SET NOT NULL,
+	DROP COLUMN phone_number_index,
+	DROP COLUMN phone_number_enc,
+	DROP COLUMN last_name_enc,
+	DROP COLUMN first_name_enc,
+	DROP COLUMN dek,
+	DROP COLUMN key_id;
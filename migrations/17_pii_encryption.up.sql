@@ -0,0 +1,25 @@
+-- Names, phone numbers and card numbers are stored sealed under a per-row data
+-- key wrapped by the key named in key_id, and looked up by blind index. Rows
+-- written before this migration keep their plaintext until `gobank reencrypt`
+-- seals them, which should run before the server is started again.
+ALTER TABLE users
+	ADD COLUMN key_id TEXT,
+	ADD COLUMN dek BYTEA,
+	ADD COLUMN first_name_enc BYTEA,
+	ADD COLUMN last_name_enc BYTEA,
+	ADD COLUMN phone_number_enc BYTEA,
+	ADD COLUMN phone_number_index TEXT UNIQUE,
+	ALTER COLUMN first_name DROP NOT NULL,
+	ALTER COLUMN last_name DROP NOT NULL,
+	ALTER COLUMN phone_number DROP NOT NULL;
+
+ALTER TABLE cards
+	ADD COLUMN key_id TEXT,
+	ADD COLUMN dek BYTEA,
+	ADD COLUMN card_number_enc BYTEA,
+	ADD COLUMN card_number_index TEXT UNIQUE,
+	ALTER COLUMN card_number DROP NOT NULL;
+
+CREATE INDEX idx_users_key_id ON users(key_id);
+
+CREATE INDEX idx_cards_key_id ON cards(key_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS detokenization_log;
+
+DROP TABLE IF EXISTS card_tokens;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS card_tokens (
+	token VARCHAR(16) PRIMARY KEY,
+	card_id INT NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ DEFAULT NOW(),
+	FOREIGN KEY (card_id) REFERENCES cards(id) ON DELETE CASCADE
+);
+
+-- Every detokenization attempt is recorded, including ones for unknown tokens.
+CREATE TABLE IF NOT EXISTS detokenization_log (
+	id BIGSERIAL PRIMARY KEY,
+	token VARCHAR(16) NOT NULL,
+	user_id INT NOT NULL,
+	reason TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT NOW(),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_detokenization_log_token ON detokenization_log(token);
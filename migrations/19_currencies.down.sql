@@ -0,0 +1,28 @@
+-- Only lossless while every account is in US dollars and no transfer was
+-- converted: the fx accounts and their postings are dropped.
+ALTER TABLE standing_orders
+	DROP COLUMN IF EXISTS allow_conversion,
+	DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE scheduled_transfers
+	DROP COLUMN IF EXISTS allow_conversion,
+	DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE holds DROP COLUMN IF EXISTS currency;
+
+DROP TABLE IF EXISTS exchange_rates;
+
+ALTER TABLE transactions
+	DROP COLUMN IF EXISTS exchange_rate,
+	DROP COLUMN IF EXISTS converted_currency,
+	DROP COLUMN IF EXISTS converted_amount,
+	DROP COLUMN IF EXISTS currency;
+
+DELETE FROM accounts WHERE system_name IS NOT NULL AND (currency <> 'USD' OR system_name = 'fx');
+
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_system_name_currency_key;
+ALTER TABLE accounts ADD CONSTRAINT accounts_system_name_key UNIQUE (system_name);
+
+ALTER TABLE accounts DROP COLUMN IF EXISTS currency;
+
+DROP TABLE IF EXISTS currencies;
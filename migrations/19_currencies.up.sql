@@ -0,0 +1,49 @@
+-- ISO 4217 currencies accounts can be held in. All of them have two minor
+-- units, which is what Money assumes.
+CREATE TABLE IF NOT EXISTS currencies (
+	code CHAR(3) PRIMARY KEY
+);
+
+INSERT INTO currencies(code) VALUES('USD'), ('EUR'), ('GBP'), ('CHF'), ('CAD');
+
+-- Existing accounts and transactions were all in US dollars.
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD' REFERENCES currencies(code);
+
+-- Every currency gets its own set of system accounts so each currency's
+-- postings balance on their own. Conversions go through the fx accounts.
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_system_name_key;
+ALTER TABLE accounts ADD CONSTRAINT accounts_system_name_currency_key UNIQUE (system_name, currency);
+
+INSERT INTO accounts(user_id, balance, system_name, currency)
+SELECT NULL, 0, system_accounts.name, currencies.code
+FROM (VALUES ('cash'), ('interest'), ('fx')) AS system_accounts(name)
+CROSS JOIN currencies
+ON CONFLICT (system_name, currency) DO NOTHING;
+
+-- A transaction is recorded in the currency of the debited account. A
+-- converted transfer also records what the recipient was credited.
+ALTER TABLE transactions
+	ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD' REFERENCES currencies(code),
+	ADD COLUMN IF NOT EXISTS converted_amount BIGINT,
+	ADD COLUMN IF NOT EXISTS converted_currency CHAR(3) REFERENCES currencies(code),
+	ADD COLUMN IF NOT EXISTS exchange_rate NUMERIC(18,8);
+
+-- Units of quote currency per unit of base currency.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+	base CHAR(3) NOT NULL REFERENCES currencies(code),
+	quote CHAR(3) NOT NULL REFERENCES currencies(code),
+	rate NUMERIC(18,8) NOT NULL CHECK (rate > 0),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (base, quote),
+	CHECK (base <> quote)
+);
+
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD' REFERENCES currencies(code);
+
+ALTER TABLE scheduled_transfers
+	ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD' REFERENCES currencies(code),
+	ADD COLUMN IF NOT EXISTS allow_conversion BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE standing_orders
+	ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD' REFERENCES currencies(code),
+	ADD COLUMN IF NOT EXISTS allow_conversion BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- A retried schedule request replays the scheduled transfer it created.
+ALTER TABLE idempotency_keys
+	ADD COLUMN IF NOT EXISTS scheduled_transfer_id UUID REFERENCES scheduled_transfers(id) ON DELETE CASCADE;
@@ -0,0 +1,3 @@
+ALTER TABLE cards
+	DROP COLUMN IF EXISTS verification_locked_until,
+	DROP COLUMN IF EXISTS failed_verifications;
@@ -0,0 +1,4 @@
+-- Card verification is locked for a while after too many failed attempts.
+ALTER TABLE cards
+	ADD COLUMN IF NOT EXISTS failed_verifications INT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS verification_locked_until TIMESTAMPTZ;
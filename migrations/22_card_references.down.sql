@@ -0,0 +1,31 @@
+-- Rows written since the migration have no card numbers to fall back to, so
+-- this fails on them until the numbers are restored. Stored idempotent
+-- responses are lost; retrying those requests reports a reused key.
+ALTER TABLE idempotency_keys ADD COLUMN transaction JSONB;
+
+ALTER TABLE idempotency_keys DROP COLUMN transaction_id;
+
+ALTER TABLE standing_orders
+	ALTER COLUMN to_card_number SET NOT NULL,
+	ALTER COLUMN from_card_number SET NOT NULL,
+	DROP COLUMN to_card_id,
+	DROP COLUMN from_card_id;
+
+ALTER TABLE scheduled_transfers
+	ALTER COLUMN to_card_number SET NOT NULL,
+	ALTER COLUMN from_card_number SET NOT NULL,
+	DROP COLUMN to_card_id,
+	DROP COLUMN from_card_id;
+
+ALTER TABLE holds
+	ALTER COLUMN merchant_card_number SET NOT NULL,
+	ALTER COLUMN card_number SET NOT NULL,
+	DROP COLUMN merchant_card_id,
+	DROP COLUMN card_id;
+
+ALTER TABLE transactions
+	ALTER COLUMN from_card_number SET DEFAULT '',
+	ALTER COLUMN from_card_number SET NOT NULL,
+	ALTER COLUMN to_card_number SET NOT NULL,
+	DROP COLUMN from_card_id,
+	DROP COLUMN to_card_id;
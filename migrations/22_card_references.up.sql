@@ -0,0 +1,39 @@
+-- Transactions, holds, scheduled transfers and standing orders reference cards
+-- by id instead of repeating their numbers in plaintext. Finding the card of a
+-- number takes the blind index key, so rows written before this migration keep
+-- their numbers until `gobank reencrypt` replaces them with references, which
+-- should run before the server is started again.
+ALTER TABLE transactions
+	ADD COLUMN to_card_id INT REFERENCES cards(id) ON DELETE SET NULL,
+	ADD COLUMN from_card_id INT REFERENCES cards(id) ON DELETE SET NULL,
+	ALTER COLUMN to_card_number DROP NOT NULL,
+	ALTER COLUMN from_card_number DROP NOT NULL,
+	ALTER COLUMN from_card_number DROP DEFAULT;
+
+ALTER TABLE holds
+	ADD COLUMN card_id INT REFERENCES cards(id) ON DELETE SET NULL,
+	ADD COLUMN merchant_card_id INT REFERENCES cards(id) ON DELETE SET NULL,
+	ALTER COLUMN card_number DROP NOT NULL,
+	ALTER COLUMN merchant_card_number DROP NOT NULL;
+
+ALTER TABLE scheduled_transfers
+	ADD COLUMN from_card_id INT REFERENCES cards(id) ON DELETE SET NULL,
+	ADD COLUMN to_card_id INT REFERENCES cards(id) ON DELETE SET NULL,
+	ALTER COLUMN from_card_number DROP NOT NULL,
+	ALTER COLUMN to_card_number DROP NOT NULL;
+
+ALTER TABLE standing_orders
+	ADD COLUMN from_card_id INT REFERENCES cards(id) ON DELETE SET NULL,
+	ADD COLUMN to_card_id INT REFERENCES cards(id) ON DELETE SET NULL,
+	ALTER COLUMN from_card_number DROP NOT NULL,
+	ALTER COLUMN to_card_number DROP NOT NULL;
+
+-- A retried request replays the stored transaction by id rather than from a
+-- copy of it holding both card numbers.
+ALTER TABLE idempotency_keys ADD COLUMN transaction_id UUID REFERENCES transactions(transaction_id) ON DELETE CASCADE;
+
+UPDATE idempotency_keys
+SET transaction_id = (transaction->>'id')::UUID
+WHERE transaction IS NOT NULL;
+
+ALTER TABLE idempotency_keys DROP COLUMN transaction;
@@ -0,0 +1,5 @@
+ALTER TABLE transactions ALTER COLUMN amount TYPE NUMERIC(8,2) USING (amount::NUMERIC / 100);
+
+ALTER TABLE accounts ALTER COLUMN balance DROP DEFAULT;
+ALTER TABLE accounts ALTER COLUMN balance TYPE NUMERIC(15,2) USING (balance::NUMERIC / 100);
+ALTER TABLE accounts ALTER COLUMN balance SET DEFAULT 0.00;
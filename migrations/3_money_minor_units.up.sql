@@ -0,0 +1,5 @@
+ALTER TABLE accounts ALTER COLUMN balance DROP DEFAULT;
+ALTER TABLE accounts ALTER COLUMN balance TYPE BIGINT USING (balance * 100)::BIGINT;
+ALTER TABLE accounts ALTER COLUMN balance SET DEFAULT 0;
+
+ALTER TABLE transactions ALTER COLUMN amount TYPE BIGINT USING (amount * 100)::BIGINT;
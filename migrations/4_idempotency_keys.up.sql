@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	user_id INT NOT NULL,
+	idempotency_key VARCHAR(255) NOT NULL,
+	request_hash VARCHAR(64) NOT NULL,
+	transaction JSONB,
+	created_at TIMESTAMPTZ DEFAULT NOW(),
+	PRIMARY KEY (user_id, idempotency_key),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
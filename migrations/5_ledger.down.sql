@@ -0,0 +1,36 @@
+DROP VIEW IF EXISTS ledger_balances;
+
+DROP TRIGGER IF EXISTS postings_balanced ON postings;
+DROP FUNCTION IF EXISTS check_postings_balanced();
+
+ALTER TABLE postings DROP CONSTRAINT IF EXISTS postings_transaction_id_fkey;
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_pkey;
+ALTER TABLE transactions ADD COLUMN account_id INT;
+
+-- Restore one row per customer leg: the debited (or deposited) account keeps
+-- the original row, transfer recipients get a copy.
+UPDATE transactions
+SET account_id = (
+	SELECT postings.account_id FROM postings
+	JOIN accounts ON postings.account_id = accounts.id
+	WHERE postings.transaction_id = transactions.transaction_id AND accounts.system_name IS NULL
+	ORDER BY postings.amount
+	LIMIT 1
+);
+
+INSERT INTO transactions(transaction_id, account_id, transaction_type, amount, to_card_number, from_card_number, created_at)
+SELECT transactions.transaction_id, postings.account_id, transactions.transaction_type, transactions.amount, transactions.to_card_number, transactions.from_card_number, transactions.created_at
+FROM transactions
+JOIN postings ON transactions.transaction_id = postings.transaction_id
+WHERE transactions.from_card_number <> '' AND postings.amount > 0;
+
+DELETE FROM transactions WHERE account_id IS NULL;
+ALTER TABLE transactions ALTER COLUMN account_id SET NOT NULL;
+ALTER TABLE transactions ADD FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_transaction_id ON transactions(transaction_id);
+
+DROP TABLE IF EXISTS postings;
+
+DELETE FROM accounts WHERE system_name IS NOT NULL;
+ALTER TABLE accounts DROP COLUMN IF EXISTS system_name;
+ALTER TABLE accounts ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,64 @@
+ALTER TABLE accounts ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS system_name VARCHAR(20) UNIQUE;
+
+INSERT INTO accounts(user_id, balance, system_name) VALUES(NULL, 0, 'cash');
+
+-- Every operation is journaled as postings that sum to zero. A positive amount
+-- credits the account (increases its balance), a negative amount debits it.
+CREATE TABLE IF NOT EXISTS postings (
+	id BIGSERIAL PRIMARY KEY,
+	transaction_id UUID NOT NULL,
+	account_id INT NOT NULL,
+	amount BIGINT NOT NULL CHECK (amount <> 0),
+	created_at TIMESTAMPTZ DEFAULT NOW(),
+	FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_postings_transaction_id ON postings(transaction_id);
+CREATE INDEX idx_postings_account_id ON postings(account_id);
+
+-- Backfill postings from the transaction history: deposits are funded by the
+-- cash account, transfer legs are signed by comparing against the sender card.
+INSERT INTO postings(transaction_id, account_id, amount, created_at)
+SELECT transaction_id, account_id,
+	CASE
+		WHEN from_card_number = '' THEN amount
+		WHEN account_id = (SELECT account_id FROM cards WHERE card_number = from_card_number) THEN -amount
+		ELSE amount
+	END,
+	created_at
+FROM transactions;
+
+INSERT INTO postings(transaction_id, account_id, amount, created_at)
+SELECT transaction_id, (SELECT id FROM accounts WHERE system_name = 'cash'), -amount, created_at
+FROM transactions
+WHERE from_card_number = '';
+
+-- Transfers used to be stored once per leg, keep a single journal row.
+DELETE FROM transactions a USING transactions b
+WHERE a.transaction_id = b.transaction_id AND a.ctid > b.ctid;
+
+DROP INDEX IF EXISTS idx_transaction_id;
+ALTER TABLE transactions DROP COLUMN account_id;
+ALTER TABLE transactions ADD PRIMARY KEY (transaction_id);
+ALTER TABLE postings ADD FOREIGN KEY (transaction_id) REFERENCES transactions(transaction_id) ON DELETE CASCADE;
+
+CREATE OR REPLACE FUNCTION check_postings_balanced() RETURNS TRIGGER AS $$
+BEGIN
+	IF (SELECT SUM(amount) FROM postings WHERE transaction_id = NEW.transaction_id) <> 0 THEN
+		RAISE EXCEPTION 'postings of transaction % do not balance', NEW.transaction_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced
+AFTER INSERT ON postings
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW EXECUTE FUNCTION check_postings_balanced();
+
+CREATE OR REPLACE VIEW ledger_balances AS
+SELECT accounts.id AS account_id, COALESCE(SUM(postings.amount), 0)::BIGINT AS balance
+FROM accounts
+LEFT JOIN postings ON accounts.id = postings.account_id
+GROUP BY accounts.id;
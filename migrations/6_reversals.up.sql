@@ -0,0 +1,3 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reversal_of UUID REFERENCES transactions(transaction_id) ON DELETE CASCADE;
+
+CREATE INDEX idx_transactions_reversal_of ON transactions(reversal_of);
@@ -0,0 +1,3 @@
+DROP FUNCTION IF EXISTS held_amount(INT);
+
+DROP TABLE IF EXISTS holds;
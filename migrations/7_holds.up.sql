@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS holds (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	account_id INT NOT NULL,
+	card_number VARCHAR(16) NOT NULL,
+	merchant_card_number VARCHAR(16) NOT NULL,
+	amount BIGINT NOT NULL CHECK (amount > 0),
+	captured_amount BIGINT NOT NULL DEFAULT 0 CHECK (captured_amount >= 0 AND captured_amount <= amount),
+	status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'captured', 'released', 'expired')),
+	transaction_id UUID REFERENCES transactions(transaction_id),
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT NOW(),
+	FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_holds_account_id_pending ON holds(account_id) WHERE status = 'pending';
+
+-- Amount reserved on the account by pending, unexpired holds. The available
+-- balance is the ledger balance minus this amount.
+CREATE OR REPLACE FUNCTION held_amount(acc INT) RETURNS BIGINT AS $$
+	SELECT COALESCE(SUM(amount), 0)::BIGINT
+	FROM holds
+	WHERE account_id = acc AND status = 'pending' AND expires_at > NOW();
+$$ LANGUAGE SQL STABLE;
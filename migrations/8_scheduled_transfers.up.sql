@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS scheduled_transfers (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id INT NOT NULL,
+	from_card_number VARCHAR(16) NOT NULL,
+	to_card_number VARCHAR(16) NOT NULL,
+	amount BIGINT NOT NULL CHECK (amount > 0),
+	execute_at TIMESTAMPTZ NOT NULL,
+	status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processing', 'executed', 'failed', 'cancelled')),
+	failure_reason TEXT NOT NULL DEFAULT '',
+	transaction_id UUID REFERENCES transactions(transaction_id),
+	claimed_at TIMESTAMPTZ,
+	executed_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT NOW(),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_scheduled_transfers_due ON scheduled_transfers(execute_at) WHERE status IN ('pending', 'processing');
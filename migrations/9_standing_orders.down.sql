@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS standing_order_runs;
+
+DROP TABLE IF EXISTS standing_orders;
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS standing_orders (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id INT NOT NULL,
+	from_card_number VARCHAR(16) NOT NULL,
+	to_card_number VARCHAR(16) NOT NULL,
+	amount BIGINT NOT NULL CHECK (amount > 0),
+	frequency VARCHAR(10) NOT NULL CHECK (frequency IN ('daily', 'weekly', 'monthly')),
+	start_at TIMESTAMPTZ NOT NULL,
+	end_at TIMESTAMPTZ,
+	next_run_at TIMESTAMPTZ NOT NULL,
+	period INT NOT NULL DEFAULT 0,
+	attempts INT NOT NULL DEFAULT 0,
+	max_retries INT NOT NULL DEFAULT 3 CHECK (max_retries >= 0),
+	status VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'completed', 'cancelled')),
+	claimed_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT NOW(),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_standing_orders_due ON standing_orders(next_run_at) WHERE status = 'active';
+CREATE INDEX idx_standing_orders_user_id ON standing_orders(user_id);
+
+CREATE TABLE IF NOT EXISTS standing_order_runs (
+	id BIGSERIAL PRIMARY KEY,
+	standing_order_id UUID NOT NULL,
+	scheduled_for TIMESTAMPTZ NOT NULL,
+	attempt INT NOT NULL,
+	status VARCHAR(10) NOT NULL CHECK (status IN ('executed', 'failed')),
+	failure_reason TEXT NOT NULL DEFAULT '',
+	transaction_id UUID REFERENCES transactions(transaction_id),
+	created_at TIMESTAMPTZ DEFAULT NOW(),
+	FOREIGN KEY (standing_order_id) REFERENCES standing_orders(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_standing_order_runs_order_id ON standing_order_runs(standing_order_id);
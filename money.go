@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	errInvalidAmount   = errors.New("amount should be a decimal number")
+	errAmountPrecision = errors.New("amount should have at most two fractional digits")
+)
+
+// Money is an exact amount in minor units (cents). It is encoded in JSON as a
+// decimal number with two fractional digits and stored in Postgres as BIGINT.
+type Money int64
+
+// ParseMoney parses a decimal string such as "12.34" into minor units.
+func ParseMoney(s string) (Money, error) {
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || !isDigits(whole) || !isDigits(frac) {
+		return 0, errInvalidAmount
+	}
+
+	if len(frac) > 2 {
+		return 0, errAmountPrecision
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units >= math.MaxInt64/100 {
+		return 0, errInvalidAmount
+	}
+
+	cents, _ := strconv.Atoi((frac + "00")[:2])
+
+	m := Money(units*100 + int64(cents))
+	if negative {
+		m = -m
+	}
+
+	return m, nil
+}
+
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts both JSON numbers and strings without going through
+// float64. Strings must be quoted on both sides.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if strings.HasPrefix(s, `"`) || strings.HasSuffix(s, `"`) {
+		if len(s) < 2 || !strings.HasPrefix(s, `"`) || !strings.HasSuffix(s, `"`) {
+			return errInvalidAmount
+		}
+		s = s[1 : len(s)-1]
+	}
+
+	money, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+
+	*m = money
+
+	return nil
+}
+
+func (m Money) Int64Value() (pgtype.Int8, error) {
+	return pgtype.Int8{Int64: int64(m), Valid: true}, nil
+}
+
+func (m *Money) ScanInt64(v pgtype.Int8) error {
+	if !v.Valid {
+		return fmt.Errorf("cannot scan NULL into Money")
+	}
+
+	*m = Money(v.Int64)
+
+	return nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
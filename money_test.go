@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Money
+	}{
+		{input: "0", expected: 0},
+		{input: "1", expected: 100},
+		{input: "1.5", expected: 150},
+		{input: "0.01", expected: 1},
+		{input: "12.34", expected: 1234},
+		{input: "-7.05", expected: -705},
+		{input: "1000000.99", expected: 100000099},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			m, err := ParseMoney(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, m)
+		})
+	}
+}
+
+func TestParseMoney_Invalid(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedErr error
+	}{
+		{input: "", expectedErr: errInvalidAmount},
+		{input: "abc", expectedErr: errInvalidAmount},
+		{input: ".5", expectedErr: errInvalidAmount},
+		{input: "1e3", expectedErr: errInvalidAmount},
+		{input: "1.2.3", expectedErr: errInvalidAmount},
+		{input: "99999999999999999999", expectedErr: errInvalidAmount},
+		{input: "0.001", expectedErr: errAmountPrecision},
+		{input: "10.999", expectedErr: errAmountPrecision},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := ParseMoney(tt.input)
+			require.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var req TransactionRequest
+
+	err := json.Unmarshal([]byte(`{"amount": 10.10}`), &req)
+	require.NoError(t, err)
+	assert.Equal(t, Money(1010), req.Amount)
+
+	err = json.Unmarshal([]byte(`{"amount": "0.30"}`), &req)
+	require.NoError(t, err)
+	assert.Equal(t, Money(30), req.Amount)
+
+	err = json.Unmarshal([]byte(`{"amount": 0.105}`), &req)
+	require.ErrorIs(t, err, errAmountPrecision)
+
+	for _, input := range []string{`"12.34`, `12.34"`, `""12.34""`, `"`} {
+		var m Money
+		require.ErrorIs(t, m.UnmarshalJSON([]byte(input)), errInvalidAmount, input)
+	}
+
+	data, err := json.Marshal(Transaction{Amount: 1005})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"amount":10.05`)
+
+	data, err = json.Marshal(Account{Balance: -50})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"balance":-0.50`)
+}
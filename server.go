@@ -15,13 +15,17 @@ import (
 type Server struct {
 	listenAddr string
 	store      Storer
+	tokens     *TokenManager
+	clock      Clock
 	quitch     chan os.Signal
 }
 
-func NewServer(listenAddr string, store Storer) *Server {
+func NewServer(listenAddr string, store Storer, tokens *TokenManager) *Server {
 	return &Server{
 		listenAddr: listenAddr,
 		store:      store,
+		tokens:     tokens,
+		clock:      systemClock{},
 		quitch:     make(chan os.Signal, 1),
 	}
 }
@@ -30,16 +34,78 @@ func (s *Server) Run(ctx context.Context) {
 	router := chi.NewRouter()
 
 	router.Post("/user", makeHTTPFunc(s.handleRegister))
-	router.Post("/transaction", makeHTTPFunc(s.handleTransaction))
-	router.Get("/user/{id}/transactions", makeHTTPFunc(s.handleGetTransactionsByUser))
-	router.Get("/user/{id}", makeHTTPFunc(s.handleGetUserByID))
-	router.Get("/users", makeHTTPFunc(s.handleGetUsers))
+	router.Post("/login", makeHTTPFunc(s.handleLogin))
+	router.Post("/refresh", makeHTTPFunc(s.handleRefresh))
+
+	router.Group(func(r chi.Router) {
+		r.Use(s.authenticate)
+
+		r.Post("/transaction", makeHTTPFunc(s.handleTransaction))
+		r.With(requireRole(roleAdmin)).Post("/transaction/{id}/reverse", makeHTTPFunc(s.handleReverseTransaction))
+		r.Post("/holds", makeHTTPFunc(s.handlePlaceHold))
+		r.Post("/holds/{id}/capture", makeHTTPFunc(s.handleCaptureHold))
+		r.Post("/holds/{id}/release", makeHTTPFunc(s.handleReleaseHold))
+		r.Get("/scheduled-transfers/{id}", makeHTTPFunc(s.handleGetScheduledTransfer))
+		r.Delete("/scheduled-transfers/{id}", makeHTTPFunc(s.handleCancelScheduledTransfer))
+		r.Route("/standing-orders", func(r chi.Router) {
+			r.Post("/", makeHTTPFunc(s.handleCreateStandingOrder))
+			r.Get("/", makeHTTPFunc(s.handleGetStandingOrders))
+			r.Get("/{id}", makeHTTPFunc(s.handleGetStandingOrder))
+			r.Patch("/{id}", makeHTTPFunc(s.handleUpdateStandingOrder))
+			r.Delete("/{id}", makeHTTPFunc(s.handleCancelStandingOrder))
+			r.Get("/{id}/runs", makeHTTPFunc(s.handleGetStandingOrderRuns))
+		})
+		r.Post("/user/{id}/accounts", makeHTTPFunc(s.handleOpenAccount))
+		r.Post("/accounts/{id}/cards", makeHTTPFunc(s.handleIssueCard))
+		r.Get("/accounts/{id}/cards", makeHTTPFunc(s.handleGetCards))
+		r.Post("/cards/authorize", makeHTTPFunc(s.handleVerifyCard))
+		r.Post("/cards/{id}/freeze", makeHTTPFunc(s.handleFreezeCard))
+		r.Post("/cards/{id}/unfreeze", makeHTTPFunc(s.handleUnfreezeCard))
+		r.Post("/cards/{id}/block", makeHTTPFunc(s.handleBlockCard))
+		r.Post("/cards/{id}/replace", makeHTTPFunc(s.handleReplaceCard))
+		r.Post("/cards/{id}/activate", makeHTTPFunc(s.handleActivateCard))
+		r.Post("/cards/{id}/token", makeHTTPFunc(s.handleTokenizeCard))
+		r.Get("/user/{id}/notifications", makeHTTPFunc(s.handleGetNotifications))
+		r.Get("/user/{id}/transactions", makeHTTPFunc(s.handleGetTransactionsByUser))
+		r.Get("/user/{id}", makeHTTPFunc(s.handleGetUserByID))
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(requireRole(roleAdmin))
+
+			r.Get("/users", makeHTTPFunc(s.handleGetUsers))
+			r.Get("/accounts/{id}/limits", makeHTTPFunc(s.handleGetLimits))
+			r.Put("/accounts/{id}/limits", makeHTTPFunc(s.handleUpdateLimits))
+			r.Put("/accounts/{id}/overdraft", makeHTTPFunc(s.handleGrantOverdraft))
+			r.Delete("/accounts/{id}/overdraft", makeHTTPFunc(s.handleRevokeOverdraft))
+			r.Get("/interest-rates", makeHTTPFunc(s.handleGetInterestRates))
+			r.Put("/interest-rates/{type}", makeHTTPFunc(s.handleSetInterestRate))
+			r.Get("/exchange-rates", makeHTTPFunc(s.handleGetExchangeRates))
+			r.Put("/exchange-rates/{base}/{quote}", makeHTTPFunc(s.handleSetExchangeRate))
+			r.Post("/tokens/{token}/detokenize", makeHTTPFunc(s.handleDetokenize))
+			r.Get("/detokenizations", makeHTTPFunc(s.handleGetDetokenizations))
+		})
+
+		r.Route("/support", func(r chi.Router) {
+			r.Use(requireRole(roleSupport, roleAdmin))
+
+			r.Get("/users", makeHTTPFunc(s.handleGetMaskedUsers))
+		})
+	})
 
 	srv := &http.Server{
 		Addr:    s.listenAddr,
 		Handler: router,
 	}
 
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	go s.runHoldExpiry(workerCtx)
+	go s.runScheduledTransfers(workerCtx)
+	go s.runStandingOrders(workerCtx)
+	go s.runInterest(workerCtx)
+	go s.runCardReissue(workerCtx)
+
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal(err)
@@ -0,0 +1,92 @@
+package main
+
+import "time"
+
+const (
+	frequencyDaily   = "daily"
+	frequencyWeekly  = "weekly"
+	frequencyMonthly = "monthly"
+
+	standingOrderActive    = "active"
+	standingOrderCompleted = "completed"
+	standingOrderCancelled = "cancelled"
+
+	runExecuted = "executed"
+	runFailed   = "failed"
+
+	defaultStandingOrderRetries = 3
+	maxStandingOrderRetries     = 10
+	standingOrderRetryDelay     = time.Hour * 24
+)
+
+// NewStandingOrder builds an active standing order whose first run is at StartAt.
+func NewStandingOrder(req *StandingOrderRequest) StandingOrder {
+	maxRetries := defaultStandingOrderRetries
+	if req.MaxRetries != nil {
+		maxRetries = *req.MaxRetries
+	}
+
+	return StandingOrder{
+		UserID:         req.UserID,
+		FromCardNumber: req.FromCardNumber,
+		ToCardNumber:   req.ToCardNumber,
+		Amount:         req.Amount,
+		Currency:       req.Currency,
+		Convert:        req.Convert,
+		Frequency:      req.Frequency,
+		StartAt:        req.StartAt,
+		EndAt:          req.EndAt,
+		NextRunAt:      req.StartAt,
+		MaxRetries:     maxRetries,
+		Status:         standingOrderActive,
+	}
+}
+
+// Occurrence returns the time of the n-th run counting from StartAt. Monthly
+// orders keep the start day and fall back to the last day of shorter months.
+func (o StandingOrder) Occurrence(n int) time.Time {
+	switch o.Frequency {
+	case frequencyDaily:
+		return o.StartAt.AddDate(0, 0, n)
+	case frequencyWeekly:
+		return o.StartAt.AddDate(0, 0, 7*n)
+	default:
+		year, month, day := o.StartAt.Date()
+		hour, minute, sec := o.StartAt.Clock()
+
+		firstOfMonth := time.Date(year, month+time.Month(n), 1, hour, minute, sec, o.StartAt.Nanosecond(), o.StartAt.Location())
+		lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+
+		return firstOfMonth.AddDate(0, 0, min(day, lastDay)-1)
+	}
+}
+
+// Succeed moves the order on to its next occurrence.
+func (o *StandingOrder) Succeed() {
+	o.advance()
+}
+
+// Fail records a failed attempt of the current occurrence. The run is retried
+// after the retry delay until MaxRetries is exhausted or the next occurrence
+// is due, then the occurrence is skipped.
+func (o *StandingOrder) Fail(now time.Time) {
+	o.Attempts++
+
+	retryAt := now.Add(standingOrderRetryDelay)
+	if o.Attempts > o.MaxRetries || !retryAt.Before(o.Occurrence(o.Period+1)) {
+		o.advance()
+		return
+	}
+
+	o.NextRunAt = retryAt
+}
+
+func (o *StandingOrder) advance() {
+	o.Period++
+	o.Attempts = 0
+	o.NextRunAt = o.Occurrence(o.Period)
+
+	if o.EndAt != nil && o.NextRunAt.After(*o.EndAt) {
+		o.Status = standingOrderCompleted
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStandingOrderOccurrence(t *testing.T) {
+	start := time.Date(2025, time.January, 31, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		frequency string
+		n         int
+		expected  time.Time
+	}{
+		{name: "Daily first run", frequency: frequencyDaily, n: 0, expected: start},
+		{name: "Daily", frequency: frequencyDaily, n: 3, expected: time.Date(2025, time.February, 3, 9, 30, 0, 0, time.UTC)},
+		{name: "Weekly", frequency: frequencyWeekly, n: 2, expected: time.Date(2025, time.February, 14, 9, 30, 0, 0, time.UTC)},
+		{name: "Monthly short month", frequency: frequencyMonthly, n: 1, expected: time.Date(2025, time.February, 28, 9, 30, 0, 0, time.UTC)},
+		{name: "Monthly keeps start day", frequency: frequencyMonthly, n: 2, expected: time.Date(2025, time.March, 31, 9, 30, 0, 0, time.UTC)},
+		{name: "Monthly short month next year", frequency: frequencyMonthly, n: 13, expected: time.Date(2026, time.February, 28, 9, 30, 0, 0, time.UTC)},
+		{name: "Monthly next year", frequency: frequencyMonthly, n: 12, expected: time.Date(2026, time.January, 31, 9, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := StandingOrder{Frequency: tt.frequency, StartAt: start}
+			assert.Equal(t, tt.expected, order.Occurrence(tt.n))
+		})
+	}
+}
+
+func TestStandingOrderRetries(t *testing.T) {
+	start := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, time.April, 15, 0, 0, 0, 0, time.UTC)
+
+	order := NewStandingOrder(&StandingOrderRequest{
+		Frequency: frequencyMonthly,
+		StartAt:   start,
+		EndAt:     &end,
+	})
+
+	assert.Equal(t, start, order.NextRunAt)
+	assert.Equal(t, defaultStandingOrderRetries, order.MaxRetries)
+
+	now := start
+	for i := 1; i <= order.MaxRetries; i++ {
+		order.Fail(now)
+		assert.Equal(t, i, order.Attempts)
+		assert.Equal(t, 0, order.Period)
+		assert.Equal(t, now.Add(standingOrderRetryDelay), order.NextRunAt)
+		now = order.NextRunAt
+	}
+
+	order.Fail(now)
+	assert.Equal(t, 0, order.Attempts)
+	assert.Equal(t, 1, order.Period)
+	assert.Equal(t, time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC), order.NextRunAt)
+	assert.Equal(t, standingOrderActive, order.Status)
+
+	order.Succeed()
+	assert.Equal(t, 2, order.Period)
+	assert.Equal(t, standingOrderCompleted, order.Status)
+}
+
+func TestStandingOrderRetrySkipsToNextOccurrence(t *testing.T) {
+	start := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	order := NewStandingOrder(&StandingOrderRequest{
+		Frequency: frequencyDaily,
+		StartAt:   start,
+	})
+
+	order.Fail(start)
+	assert.Equal(t, 0, order.Attempts)
+	assert.Equal(t, 1, order.Period)
+	assert.Equal(t, start.AddDate(0, 0, 1), order.NextRunAt)
+}
@@ -1,12 +1,65 @@
 package main
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Storer interface {
 	Register(context.Context, *User) (int, error)
 	Deposit(context.Context, *TransactionRequest) (Transaction, error)
 	Transfer(context.Context, *TransactionRequest) (Transaction, error)
+	Withdraw(context.Context, *TransactionRequest) (Transaction, error)
+	Reverse(context.Context, *ReversalRequest) (Transaction, error)
+	PlaceHold(context.Context, *HoldRequest) (Hold, error)
+	HoldByID(context.Context, uuid.UUID) (Hold, error)
+	CaptureHold(context.Context, *CaptureRequest) (Transaction, error)
+	ReleaseHold(context.Context, uuid.UUID) (Hold, error)
+	ExpireHolds(context.Context) (int, error)
+	ScheduleTransfer(context.Context, *TransactionRequest) (ScheduledTransfer, error)
+	ScheduledTransferByID(context.Context, uuid.UUID) (ScheduledTransfer, error)
+	CancelScheduledTransfer(context.Context, uuid.UUID) (ScheduledTransfer, error)
+	ClaimDueScheduledTransfers(context.Context, int) ([]ScheduledTransfer, error)
+	FinishScheduledTransfer(context.Context, *ScheduledTransfer) error
+	CreateStandingOrder(context.Context, *StandingOrder) error
+	StandingOrderByID(context.Context, uuid.UUID) (StandingOrder, error)
+	StandingOrdersByUser(context.Context, int) ([]StandingOrder, error)
+	UpdateStandingOrder(context.Context, *StandingOrderUpdate) (StandingOrder, error)
+	CancelStandingOrder(context.Context, uuid.UUID) (StandingOrder, error)
+	ClaimDueStandingOrders(context.Context, int) ([]StandingOrder, error)
+	RecordStandingOrderRun(context.Context, *StandingOrder, *StandingOrderRun) error
+	StandingOrderRuns(context.Context, uuid.UUID) ([]StandingOrderRun, error)
 	UserByID(context.Context, int) (User, error)
+	OpenAccount(context.Context, int, *Account) error
+	AccountByID(context.Context, int) (Account, error)
+	IssueCard(context.Context, int, *Card) error
+	CardsByAccount(context.Context, int) ([]Card, error)
+	CardByID(context.Context, int) (Card, error)
+	UpdateCardStatus(context.Context, int, []string, string) (Card, error)
+	ReplaceCard(context.Context, int, *Card) error
+	ActivateCard(context.Context, *Card) error
+	ExpiringCards(context.Context, time.Time, int) ([]Card, error)
+	ReissueCard(context.Context, int, *Card) error
+	NotificationsByUser(context.Context, int) ([]Notification, error)
+	VerifyCard(context.Context, *CardVerificationRequest) error
+	TokenizeCard(context.Context, Card) (CardToken, error)
+	CardByToken(context.Context, string) (Card, error)
+	Detokenize(context.Context, *DetokenizeRequest) (Card, error)
+	Detokenizations(context.Context) ([]Detokenization, error)
+	LimitsByAccount(context.Context, int) (AccountLimits, error)
+	UpdateLimits(context.Context, int, *AccountLimits) (AccountLimits, error)
+	SetOverdraft(context.Context, int, Money) (Account, error)
+	InterestRates(context.Context) ([]InterestRate, error)
+	SetInterestRate(context.Context, *InterestRate) (InterestRate, error)
+	ExchangeRates(context.Context) ([]ExchangeRate, error)
+	SetExchangeRate(context.Context, *ExchangeRate) (ExchangeRate, error)
+	AccrueInterest(context.Context, time.Time) error
+	CapitalizeInterest(context.Context, time.Time) (int, error)
+	UserByPhoneNumber(context.Context, string) (User, error)
+	CardOwner(context.Context, string) (int, error)
+	CardExists(context.Context, string) (bool, error)
 	TransactionsByUser(context.Context, int) ([]Transaction, error)
 	Users(context.Context) ([]User, error)
 }
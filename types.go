@@ -1,16 +1,58 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
-	"golang.org/x/exp/rand"
 )
 
-const layout = "01/06"
+const (
+	layout             = "01/06"
+	cardValidityMonths = 61
+	cardNumberDigits   = 16
+	defaultCardBIN     = "400000"
+)
+
+// cardBIN is the issuer prefix of every card number generated by NewCard.
+var cardBIN = defaultCardBIN
+
+// SetCardBIN sets the issuer prefix of generated card numbers. The BIN must
+// be 6 to 8 digits long.
+func SetCardBIN(bin string) error {
+	if len(bin) < 6 || len(bin) > 8 {
+		return fmt.Errorf("invalid card BIN: length should be 6 to 8, got %d", len(bin))
+	}
+
+	for i := 0; i < len(bin); i++ {
+		if bin[i] < '0' || bin[i] > '9' {
+			return fmt.Errorf("invalid card BIN: should contain only digits")
+		}
+	}
+
+	cardBIN = bin
+
+	return nil
+}
+
+const (
+	roleCustomer = "customer"
+	roleSupport  = "support"
+	roleAdmin    = "admin"
+)
+
+const (
+	cardPhysical = "physical"
+	cardVirtual  = "virtual"
+	cardActive   = "active"
+	cardFrozen   = "frozen"
+	cardBlocked  = "blocked"
+)
 
 type User struct {
 	ID           int       `json:"id"`
@@ -18,21 +60,109 @@ type User struct {
 	LastName     string    `json:"lastName"`
 	PhoneNumber  string    `json:"phoneNumber"`
 	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
 	CreatedAt    time.Time `json:"createdAt"`
-	Account      Account   `json:"account"`
+	Accounts     []Account `json:"accounts"`
 }
 
 type Account struct {
-	ID      int     `json:"id"`
-	Balance float64 `json:"balance"`
-	Card    Card    `json:"card"`
+	ID               int    `json:"id"`
+	UserID           int    `json:"-"`
+	Balance          Money  `json:"balance"`
+	AvailableBalance Money  `json:"availableBalance"`
+	OverdraftLimit   Money  `json:"overdraftLimit"`
+	Currency         string `json:"currency"`
+	Type             string `json:"type"`
+	Cards            []Card `json:"cards"`
 }
 
 type Card struct {
-	ID         int    `json:"id"`
-	Number     string `json:"number"`
-	CVV        string `json:"cvv"`
+	ID         int       `json:"id"`
+	Number     string    `json:"number"`
+	CVV        string    `json:"cvv,omitempty"`
+	ExpireTime time.Time `json:"expireTime"`
+	Kind       string    `json:"kind"`
+	Status     string    `json:"status"`
+	AccountID  int       `json:"-"`
+}
+
+type Notification struct {
+	ID        int64     `json:"id"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type NotificationsResponse struct {
+	StatusCode    int            `json:"statusCode"`
+	UserID        int            `json:"userId"`
+	Notifications []Notification `json:"notifications"`
+}
+
+type NewCardRequest struct {
+	Kind string `json:"kind"`
+}
+
+// CardToken stands in for a card number. It has the same length and last
+// four digits but never passes the Luhn check, so it can't be taken for one.
+type CardToken struct {
+	Token     string    `json:"token"`
+	CardID    int       `json:"cardId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type CardTokenResponse struct {
+	StatusCode int       `json:"statusCode"`
+	Msg        string    `json:"msg"`
+	Token      CardToken `json:"token"`
+}
+
+type DetokenizeRequest struct {
+	Token  string `json:"-"`
+	Reason string `json:"reason"`
+	UserID int    `json:"-"`
+}
+
+type DetokenizeResponse struct {
+	StatusCode int    `json:"statusCode"`
+	Token      string `json:"token"`
+	CardID     int    `json:"cardId"`
+	CardNumber string `json:"cardNumber"`
+}
+
+type Detokenization struct {
+	ID        int64     `json:"id"`
+	Token     string    `json:"token"`
+	UserID    int       `json:"userId"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type DetokenizationsResponse struct {
+	StatusCode      int              `json:"statusCode"`
+	Detokenizations []Detokenization `json:"detokenizations"`
+}
+
+type CardVerificationRequest struct {
+	CardNumber string `json:"cardNumber"`
 	ExpireTime string `json:"expireTime"`
+	CVV        string `json:"cvv"`
+}
+
+type CardVerificationResponse struct {
+	StatusCode int    `json:"statusCode"`
+	Msg        string `json:"msg"`
+}
+
+type CardResponse struct {
+	StatusCode int    `json:"statusCode"`
+	Msg        string `json:"msg"`
+	Card       Card   `json:"card"`
+}
+
+type CardsResponse struct {
+	StatusCode int    `json:"statusCode"`
+	AccountID  int    `json:"accountId"`
+	Cards      []Card `json:"cards"`
 }
 
 type UserResponse struct {
@@ -52,27 +182,270 @@ type NewUserRequest struct {
 	Password    string `json:"password"`
 }
 
+type NewAccountRequest struct {
+	Type     string `json:"type"`
+	Currency string `json:"currency"`
+}
+
+type AccountResponse struct {
+	StatusCode int     `json:"statusCode"`
+	Msg        string  `json:"msg"`
+	Account    Account `json:"account"`
+}
+
 type NewUserResponse struct {
 	StatusCode int    `json:"statusCode"`
 	Msg        string `json:"msg"`
 	ID         int    `json:"id"`
+	Card       Card   `json:"card"`
+}
+
+type LoginRequest struct {
+	PhoneNumber string `json:"phoneNumber"`
+	Password    string `json:"password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type TokenResponse struct {
+	StatusCode   int    `json:"statusCode"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
 }
 
 type Transaction struct {
-	ID             uuid.UUID `json:"id"`
-	AccountID      int       `json:"-"`
-	Type           string    `json:"type"`
-	Amount         float64   `json:"amount"`
-	FromCardNumber string    `json:"fromCardNumber,omitempty"`
-	ToCardNumber   string    `json:"toCardNumber"`
-	CreatedAt      time.Time `json:"createdAt"`
+	ID             uuid.UUID   `json:"id"`
+	AccountID      int         `json:"-"`
+	Type           string      `json:"type"`
+	Amount         Money       `json:"amount"`
+	Currency       string      `json:"currency"`
+	Conversion     *Conversion `json:"conversion,omitempty"`
+	FromCardNumber string      `json:"fromCardNumber,omitempty"`
+	ToCardNumber   string      `json:"toCardNumber,omitempty"`
+	ReversalOf     *uuid.UUID  `json:"reversalOf,omitempty"`
+	CreatedAt      time.Time   `json:"createdAt"`
+}
+
+// Conversion is what the recipient of a cross-currency transfer was credited
+// and the rate the amount was converted at.
+type Conversion struct {
+	Amount   Money  `json:"amount"`
+	Currency string `json:"currency"`
+	Rate     string `json:"rate"`
+}
+
+// Posting is a single ledger entry. A positive amount credits the account,
+// a negative amount debits it; postings of one transaction sum to zero.
+type Posting struct {
+	AccountID int
+	Amount    Money
 }
 
 type TransactionRequest struct {
-	Type           string  `json:"type"`
-	FromCardNumber string  `json:"fromCardNumber"`
-	ToCardNumber   string  `json:"toCardNumber"`
-	Amount         float64 `json:"amount"`
+	Type           string     `json:"type"`
+	FromCardNumber string     `json:"fromCardNumber"`
+	ToCardNumber   string     `json:"toCardNumber"`
+	FromAccountID  int        `json:"fromAccountId,omitempty"`
+	ToAccountID    int        `json:"toAccountId,omitempty"`
+	FromCardToken  string     `json:"fromCardToken,omitempty"`
+	ToCardToken    string     `json:"toCardToken,omitempty"`
+	Amount         Money      `json:"amount"`
+	Currency       string     `json:"currency,omitempty"`
+	Convert        bool       `json:"convert,omitempty"`
+	ExecuteAt      *time.Time `json:"executeAt,omitempty"`
+	UserID         int        `json:"-"`
+	IdempotencyKey string     `json:"-"`
+}
+
+// tokenized returns the transaction with the card numbers the request gave
+// as tokens shown as those tokens.
+func (r TransactionRequest) tokenized(t Transaction) Transaction {
+	if r.FromCardToken != "" {
+		t.FromCardNumber = r.FromCardToken
+	}
+	if r.ToCardToken != "" {
+		t.ToCardNumber = r.ToCardToken
+	}
+	return t
+}
+
+type ReversalRequest struct {
+	TransactionID uuid.UUID `json:"-"`
+	Amount        Money     `json:"amount"`
+}
+
+type Hold struct {
+	ID                 uuid.UUID  `json:"id"`
+	CardNumber         string     `json:"cardNumber"`
+	MerchantCardNumber string     `json:"merchantCardNumber"`
+	Amount             Money      `json:"amount"`
+	CapturedAmount     Money      `json:"capturedAmount"`
+	Currency           string     `json:"currency"`
+	Status             string     `json:"status"`
+	TransactionID      *uuid.UUID `json:"transactionId,omitempty"`
+	ExpiresAt          time.Time  `json:"expiresAt"`
+	CreatedAt          time.Time  `json:"createdAt"`
+}
+
+// HoldRequest is made by the merchant. The expiry date and CVV of the held
+// card prove the card is present, since the merchant doesn't own it.
+type HoldRequest struct {
+	CardNumber         string     `json:"cardNumber"`
+	CardExpireTime     string     `json:"cardExpireTime"`
+	CVV                string     `json:"cvv"`
+	MerchantCardNumber string     `json:"merchantCardNumber"`
+	Amount             Money      `json:"amount"`
+	ExpiresAt          *time.Time `json:"expiresAt"`
+}
+
+type CaptureRequest struct {
+	HoldID uuid.UUID `json:"-"`
+	Amount Money     `json:"amount"`
+}
+
+type HoldResponse struct {
+	StatusCode int    `json:"statusCode"`
+	Msg        string `json:"msg"`
+	Hold       Hold   `json:"hold"`
+}
+
+type ScheduledTransfer struct {
+	ID             uuid.UUID  `json:"id"`
+	UserID         int        `json:"userId"`
+	FromCardNumber string     `json:"fromCardNumber"`
+	ToCardNumber   string     `json:"toCardNumber"`
+	Amount         Money      `json:"amount"`
+	Currency       string     `json:"currency"`
+	Convert        bool       `json:"convert"`
+	ExecuteAt      time.Time  `json:"executeAt"`
+	Status         string     `json:"status"`
+	FailureReason  string     `json:"failureReason,omitempty"`
+	TransactionID  *uuid.UUID `json:"transactionId,omitempty"`
+	ExecutedAt     *time.Time `json:"executedAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+type ScheduledTransferResponse struct {
+	StatusCode        int               `json:"statusCode"`
+	Msg               string            `json:"msg"`
+	ScheduledTransfer ScheduledTransfer `json:"scheduledTransfer"`
+}
+
+type StandingOrder struct {
+	ID             uuid.UUID  `json:"id"`
+	UserID         int        `json:"userId"`
+	FromCardNumber string     `json:"fromCardNumber"`
+	ToCardNumber   string     `json:"toCardNumber"`
+	Amount         Money      `json:"amount"`
+	Currency       string     `json:"currency"`
+	Convert        bool       `json:"convert"`
+	Frequency      string     `json:"frequency"`
+	StartAt        time.Time  `json:"startAt"`
+	EndAt          *time.Time `json:"endAt,omitempty"`
+	NextRunAt      time.Time  `json:"nextRunAt"`
+	Period         int        `json:"-"`
+	Attempts       int        `json:"attempts"`
+	MaxRetries     int        `json:"maxRetries"`
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+type StandingOrderRequest struct {
+	FromCardNumber string     `json:"fromCardNumber"`
+	ToCardNumber   string     `json:"toCardNumber"`
+	Amount         Money      `json:"amount"`
+	Currency       string     `json:"currency"`
+	Convert        bool       `json:"convert"`
+	Frequency      string     `json:"frequency"`
+	StartAt        time.Time  `json:"startAt"`
+	EndAt          *time.Time `json:"endAt"`
+	MaxRetries     *int       `json:"maxRetries"`
+	UserID         int        `json:"-"`
+}
+
+type StandingOrderUpdate struct {
+	ID     uuid.UUID  `json:"-"`
+	Amount *Money     `json:"amount"`
+	EndAt  *time.Time `json:"endAt"`
+}
+
+type StandingOrderRun struct {
+	ID              int        `json:"id"`
+	StandingOrderID uuid.UUID  `json:"standingOrderId"`
+	ScheduledFor    time.Time  `json:"scheduledFor"`
+	Attempt         int        `json:"attempt"`
+	Status          string     `json:"status"`
+	FailureReason   string     `json:"failureReason,omitempty"`
+	TransactionID   *uuid.UUID `json:"transactionId,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+type StandingOrderResponse struct {
+	StatusCode    int           `json:"statusCode"`
+	Msg           string        `json:"msg"`
+	StandingOrder StandingOrder `json:"standingOrder"`
+}
+
+type StandingOrdersResponse struct {
+	StatusCode     int             `json:"statusCode"`
+	StandingOrders []StandingOrder `json:"standingOrders"`
+}
+
+type StandingOrderRunsResponse struct {
+	StatusCode      int                `json:"statusCode"`
+	StandingOrderID uuid.UUID          `json:"standingOrderId"`
+	Runs            []StandingOrderRun `json:"runs"`
+}
+
+type AccountLimits struct {
+	TransactionLimit Money  `json:"transactionLimit"`
+	DailyLimit       Money  `json:"dailyLimit"`
+	DailyCountLimit  int    `json:"dailyCountLimit"`
+	Currency         string `json:"currency"`
+}
+
+type LimitsResponse struct {
+	StatusCode int           `json:"statusCode"`
+	AccountID  int           `json:"accountId"`
+	Limits     AccountLimits `json:"limits"`
+}
+
+type OverdraftRequest struct {
+	Limit Money `json:"limit"`
+}
+
+type OverdraftResponse struct {
+	StatusCode     int    `json:"statusCode"`
+	Msg            string `json:"msg"`
+	AccountID      int    `json:"accountId"`
+	OverdraftLimit Money  `json:"overdraftLimit"`
+	Currency       string `json:"currency"`
+}
+
+type InterestRate struct {
+	AccountType   string `json:"accountType"`
+	AnnualRateBps int    `json:"annualRateBps"`
+}
+
+type InterestRatesResponse struct {
+	StatusCode    int            `json:"statusCode"`
+	InterestRates []InterestRate `json:"interestRates"`
+}
+
+// ExchangeRate is the number of units of the quote currency one unit of the
+// base currency converts to, as a decimal string.
+type ExchangeRate struct {
+	Base      string    `json:"base"`
+	Quote     string    `json:"quote"`
+	Rate      string    `json:"rate"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type ExchangeRatesResponse struct {
+	StatusCode    int            `json:"statusCode"`
+	ExchangeRates []ExchangeRate `json:"exchangeRates"`
 }
 
 type TransactionResponse struct {
@@ -87,6 +460,18 @@ type TransactionsResponse struct {
 	Transactions []Transaction `json:"transactions"`
 }
 
+// Fingerprint identifies the request body so a reused idempotency key can be
+// told apart from a genuine retry.
+func (r TransactionRequest) Fingerprint() string {
+	body := fmt.Sprintf("%s|%s|%s|%d|%s|%t", r.Type, r.FromCardNumber, r.ToCardNumber, r.Amount, r.Currency, r.Convert)
+	if r.ExecuteAt != nil {
+		body += "|" + r.ExecuteAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
 func NewUser(newUser *NewUserRequest) (*User, error) {
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(newUser.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -97,46 +482,169 @@ func NewUser(newUser *NewUserRequest) (*User, error) {
 		return nil, fmt.Errorf("invalid user data")
 	}
 
-	card := NewCard()
-
 	return &User{
 		FirstName:    newUser.FirstName,
 		LastName:     newUser.LastName,
 		PhoneNumber:  newUser.PhoneNumber,
 		PasswordHash: string(passwordHash),
+		Role:         roleCustomer,
 		CreatedAt:    time.Now().UTC(),
-		Account: Account{
-			Balance: 0.00,
-			Card: Card{
-				Number:     card.Number,
-				CVV:        card.CVV,
-				ExpireTime: card.ExpireTime,
-			},
-		},
+		Accounts:     []Account{NewAccount(checkingAccount, defaultCurrency)},
 	}, nil
 }
 
-func NewCard() Card {
-	var (
-		cardNumber = ""
-		cvv        = ""
-		r          = rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
-	)
-
-	for i := 1; i <= 16; i++ {
-		cardNumber += strconv.Itoa(r.Intn(10))
+// NewAccount builds an empty account of the given type and currency with a
+// new card.
+func NewAccount(accountType, currency string) Account {
+	return Account{
+		Balance:  0,
+		Currency: currency,
+		Type:     accountType,
+		Cards:    []Card{NewCard()},
+	}
+}
+
+// Expired reports whether the card is past the last day it is valid on.
+func (c Card) Expired(now time.Time) bool {
+	year, month, day := now.Date()
+	return c.ExpireTime.Before(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+}
+
+// PrimaryCard returns the first active, unexpired card of the account.
+func (a Account) PrimaryCard() (Card, bool) {
+	now := time.Now()
+	for _, c := range a.Cards {
+		if c.Status == cardActive && !c.Expired(now) {
+			return c, true
+		}
+	}
+	return Card{}, false
+}
+
+// Masked returns a copy of the card with the number reduced to its last four
+// digits and the CVV dropped.
+func (c Card) Masked() Card {
+	c.Number = maskDigits(c.Number)
+	c.CVV = ""
+	return c
+}
+
+// Masked returns a copy of the transaction with both card numbers keeping
+// only their last four digits.
+func (t Transaction) Masked() Transaction {
+	t.FromCardNumber = maskDigits(t.FromCardNumber)
+	t.ToCardNumber = maskDigits(t.ToCardNumber)
+	return t
+}
+
+// Masked returns a copy of the hold with both card numbers keeping only their
+// last four digits.
+func (h Hold) Masked() Hold {
+	h.CardNumber = maskDigits(h.CardNumber)
+	h.MerchantCardNumber = maskDigits(h.MerchantCardNumber)
+	return h
+}
+
+// Masked returns a copy of the standing order with both card numbers keeping
+// only their last four digits.
+func (o StandingOrder) Masked() StandingOrder {
+	o.FromCardNumber = maskDigits(o.FromCardNumber)
+	o.ToCardNumber = maskDigits(o.ToCardNumber)
+	return o
+}
+
+// MaskedCards returns a copy of the user with every card masked.
+func (u User) MaskedCards() User {
+	accounts := make([]Account, len(u.Accounts))
+	for i, a := range u.Accounts {
+		a.Cards = maskCards(a.Cards)
+		accounts[i] = a
+	}
+	u.Accounts = accounts
+	return u
+}
+
+// Masked returns a copy of the user safe for support staff: the phone and
+// card numbers keep only their last four digits and the CVV is dropped.
+func (u User) Masked() User {
+	u = u.MaskedCards()
+	u.PhoneNumber = maskDigits(u.PhoneNumber)
+	return u
+}
+
+func maskCards(cards []Card) []Card {
+	masked := make([]Card, len(cards))
+	for i, c := range cards {
+		masked[i] = c.Masked()
+	}
+	return masked
+}
+
+func maskDigits(s string) string {
+	if len(s) <= 4 {
+		return s
+	}
+	return strings.Repeat("*", len(s)-4) + s[len(s)-4:]
+}
+
+// randomDigits returns n decimal digits read from crypto/rand, so card
+// numbers, tokens and CVVs can't be predicted from the time they were made.
+// Bytes of 250 and above are skipped to keep every digit equally likely.
+func randomDigits(n int) []byte {
+	digits := make([]byte, 0, n)
+	buf := make([]byte, n)
+
+	for len(digits) < n {
+		if _, err := rand.Read(buf); err != nil {
+			panic(fmt.Sprintf("crypto/rand: %s", err))
+		}
+
+		for _, b := range buf {
+			if b < 250 && len(digits) < n {
+				digits = append(digits, '0'+b%10)
+			}
+		}
 	}
 
-	for i := 1; i <= 3; i++ {
-		cvv += strconv.Itoa(r.Intn(10))
+	return digits
+}
+
+// newCardNumber generates a card number starting with the issuer BIN and
+// ending with a Luhn check digit.
+func newCardNumber() string {
+	payload := cardBIN + string(randomDigits(cardNumberDigits-1-len(cardBIN)))
+
+	return payload + string(luhnCheckDigit(payload))
+}
+
+// newCardToken generates a token keeping the last four digits of the card
+// number. A token that happens to pass the Luhn check gets one digit changed,
+// which always breaks it.
+func newCardToken(cardNumber string) string {
+	token := append(randomDigits(cardNumberDigits-4), cardNumber[len(cardNumber)-4:]...)
+
+	if luhnValid(string(token)) {
+		token[0] = '0' + (token[0]-'0'+1)%10
 	}
 
+	return string(token)
+}
+
+// newCVV generates a three-digit card verification value.
+func newCVV() string {
+	return string(randomDigits(3))
+}
+
+func NewCard() Card {
 	now := time.Now()
-	expireTime := now.AddDate(0, 61, 0).Format(layout)
+	year, month, _ := now.Date()
+	expireTime := time.Date(year, month+cardValidityMonths+1, 0, 0, 0, 0, 0, time.UTC)
 
 	return Card{
-		Number:     cardNumber,
-		CVV:        cvv,
+		Number:     newCardNumber(),
+		CVV:        newCVV(),
 		ExpireTime: expireTime,
+		Kind:       cardPhysical,
+		Status:     cardActive,
 	}
 }
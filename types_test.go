@@ -15,7 +15,7 @@ const (
 	cardNumberLength  = 16
 	cvvLength         = 3
 	phoneNumberLength = 10
-	initialBalance    = 0.00
+	initialBalance    = Money(0)
 )
 
 func TestNewCard(t *testing.T) {
@@ -25,9 +25,73 @@ func TestNewCard(t *testing.T) {
 	assert.Len(t, card.CVV, cvvLength)
 	assert.Regexp(t, regexp.MustCompile(`^[0-9]+$`), card.Number)
 	assert.Regexp(t, regexp.MustCompile(`^[0-9]+$`), card.CVV)
+	assert.Equal(t, cardBIN, card.Number[:len(cardBIN)])
+	assert.True(t, luhnValid(card.Number))
 
-	expireTime := time.Now().AddDate(0, 61, 0).Format(layout)
-	assert.Equal(t, expireTime, card.ExpireTime)
+	year, month, _ := time.Now().Date()
+	expireTime := time.Date(year, month+cardValidityMonths, 1, 0, 0, 0, 0, time.UTC).Format(layout)
+	assert.Equal(t, expireTime, card.ExpireTime.Format(layout))
+	assert.Equal(t, 1, card.ExpireTime.AddDate(0, 0, 1).Day())
+	assert.Equal(t, cardPhysical, card.Kind)
+	assert.Equal(t, cardActive, card.Status)
+}
+
+func TestNewCardToken(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		card := NewCard()
+		token := newCardToken(card.Number)
+
+		assert.Len(t, token, cardNumberDigits)
+		assert.Regexp(t, regexp.MustCompile(`^[0-9]+$`), token)
+		assert.Equal(t, card.Number[12:], token[12:])
+		assert.False(t, luhnValid(token))
+	}
+}
+
+func TestNewCardToken_Unpredictable(t *testing.T) {
+	// Tokens made at the same moment for the same card must still differ.
+	cardNumber := NewCard().Number
+	tokens := make(map[string]bool)
+
+	for i := 0; i < 100; i++ {
+		tokens[newCardToken(cardNumber)] = true
+	}
+
+	assert.Len(t, tokens, 100)
+}
+
+func TestTransactionRequestTokenized(t *testing.T) {
+	req := TransactionRequest{FromCardToken: "4000001234567898", FromCardNumber: "4000001234567899", ToCardNumber: "4111111111111111"}
+
+	tr := req.tokenized(Transaction{FromCardNumber: req.FromCardNumber, ToCardNumber: req.ToCardNumber})
+
+	assert.Equal(t, "4000001234567898", tr.FromCardNumber)
+	assert.Equal(t, "4111111111111111", tr.ToCardNumber)
+}
+
+func TestCardExpired(t *testing.T) {
+	card := Card{ExpireTime: time.Date(2025, time.March, 31, 0, 0, 0, 0, time.UTC)}
+
+	assert.False(t, card.Expired(time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)))
+	assert.False(t, card.Expired(time.Date(2025, time.March, 31, 23, 59, 0, 0, time.UTC)))
+	assert.True(t, card.Expired(time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestAccountPrimaryCard(t *testing.T) {
+	account := Account{
+		Cards: []Card{
+			{Number: "1111222233334444", Status: cardBlocked, ExpireTime: time.Now().AddDate(1, 0, 0)},
+			{Number: "9999000011112222", Status: cardActive, ExpireTime: time.Now().AddDate(0, -1, 0)},
+			{Number: "5555666677778888", Status: cardActive, ExpireTime: time.Now().AddDate(1, 0, 0)},
+		},
+	}
+
+	card, ok := account.PrimaryCard()
+	require.True(t, ok)
+	assert.Equal(t, "5555666677778888", card.Number)
+
+	_, ok = Account{Cards: account.Cards[:2]}.PrimaryCard()
+	assert.False(t, ok)
 }
 
 func TestNewUser(t *testing.T) {
@@ -48,12 +112,77 @@ func TestNewUser(t *testing.T) {
 	assert.Regexp(t, regexp.MustCompile(`^[0-9]+$`), phoneNumber)
 	assert.NotEmpty(t, user.PasswordHash)
 	assert.WithinDuration(t, now, user.CreatedAt, delta)
-	assert.Equal(t, initialBalance, user.Account.Balance)
+	assert.Equal(t, initialBalance, user.Accounts[0].Balance)
+	assert.Equal(t, roleCustomer, user.Role)
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	require.NoError(t, err)
 }
 
+func TestUserMasked(t *testing.T) {
+	user := User{
+		PhoneNumber: "9876543210",
+		Accounts: []Account{{
+			Cards: []Card{{
+				Number: "1234567812345678",
+				CVV:    "123",
+			}},
+		}},
+	}
+
+	masked := user.Masked()
+
+	assert.Equal(t, "******3210", masked.PhoneNumber)
+	assert.Equal(t, "************5678", masked.Accounts[0].Cards[0].Number)
+	assert.Empty(t, masked.Accounts[0].Cards[0].CVV)
+	assert.Equal(t, "1234567812345678", user.Accounts[0].Cards[0].Number)
+}
+
+func TestUserMaskedCards(t *testing.T) {
+	user := User{
+		PhoneNumber: "9876543210",
+		Accounts: []Account{{
+			Cards: []Card{{
+				Number: "1234567812345678",
+				CVV:    "123",
+			}},
+		}},
+	}
+
+	masked := user.MaskedCards()
+
+	assert.Equal(t, "9876543210", masked.PhoneNumber)
+	assert.Equal(t, "************5678", masked.Accounts[0].Cards[0].Number)
+	assert.Empty(t, masked.Accounts[0].Cards[0].CVV)
+	assert.Equal(t, "123", user.Accounts[0].Cards[0].CVV)
+}
+
+func TestTransactionMasked(t *testing.T) {
+	transaction := Transaction{
+		FromCardNumber: "1234567812345678",
+		ToCardNumber:   "8765432187654321",
+	}
+
+	masked := transaction.Masked()
+
+	assert.Equal(t, "************5678", masked.FromCardNumber)
+	assert.Equal(t, "************4321", masked.ToCardNumber)
+	assert.Empty(t, Transaction{}.Masked().FromCardNumber)
+}
+
+func TestHoldMasked(t *testing.T) {
+	hold := Hold{
+		CardNumber:         "1234567812345678",
+		MerchantCardNumber: "8765432187654321",
+	}
+
+	masked := hold.Masked()
+
+	assert.Equal(t, "************5678", masked.CardNumber)
+	assert.Equal(t, "************4321", masked.MerchantCardNumber)
+	assert.Equal(t, "1234567812345678", hold.CardNumber)
+}
+
 func TestNewUser_Invalid(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -2,9 +2,19 @@ package main
 
 import (
 	"fmt"
+	"strings"
+	"time"
 	"unicode"
 )
 
+const (
+	maxIdempotencyKeyLength = 255
+	currencyCodeLength      = 3
+	maxRateWholeDigits      = 10
+	maxRateFractionalDigits = 8
+	invalidCheckDigit       = "invalid card number: failed Luhn check"
+)
+
 func (r NewUserRequest) ValidateUserData() map[string]string {
 	errors := make(map[string]string)
 
@@ -34,67 +44,354 @@ func (r NewUserRequest) ValidateUserData() map[string]string {
 	return errors
 }
 
+func (r LoginRequest) ValidateLogin() map[string]string {
+	errors := make(map[string]string)
+
+	if len(r.PhoneNumber) == 0 {
+		errors["phoneNumber"] = "phone number should not be empty"
+	}
+
+	if len(r.Password) == 0 {
+		errors["password"] = "password should not be empty"
+	}
+
+	return errors
+}
+
 func (r TransactionRequest) ValidateTransaction() map[string]string {
 	errors := make(map[string]string)
 
-	if r.Type != transferTransaction && r.Type != depositTransaction {
+	if r.Type != transferTransaction && r.Type != depositTransaction && r.Type != withdrawalTransaction {
 		errors["transactionType"] = "unsupported transaction"
 	}
 
-	if r.Type == transferTransaction {
+	if len(r.IdempotencyKey) > maxIdempotencyKeyLength {
+		errors["idempotencyKey"] = fmt.Sprintf("idempotency key should be at most %d characters", maxIdempotencyKeyLength)
+	}
 
-		if len(r.FromCardNumber) != 16 {
-			errors["fromCardNumber"] = fmt.Sprintf("invalid card number: length should be 16, got %d", len(r.FromCardNumber))
-		}
+	if r.Type == transferTransaction || r.Type == withdrawalTransaction {
+		validateSource(errors, "from", r.FromCardNumber, r.FromCardToken, r.FromAccountID)
+	} else if r.FromAccountID != 0 || r.FromCardToken != "" {
+		errors["fromAccountId"] = "only transfers and withdrawals debit an account"
+	}
 
-		if len(r.ToCardNumber) != 16 {
-			errors["toCardNumber"] = fmt.Sprintf("invalid card number: length should be 16, got %d", len(r.ToCardNumber))
-		}
+	if r.Type == transferTransaction || r.Type == depositTransaction {
+		validateSource(errors, "to", r.ToCardNumber, r.ToCardToken, r.ToAccountID)
+	} else if r.ToAccountID != 0 || r.ToCardToken != "" {
+		errors["toAccountId"] = "only transfers and deposits credit an account"
+	}
 
-		for _, digit := range r.FromCardNumber {
-			if !unicode.IsDigit(digit) {
-				errors["fromCardNumber"] = "card number should contains only digits"
-				break
-			}
-		}
+	if r.Amount < 0 {
+		errors["amount"] = "amount cannot be negative"
+	}
 
-		for _, digit := range r.ToCardNumber {
-			if !unicode.IsDigit(digit) {
-				errors["toCardNumber"] = "card number should contains only digits"
-				break
-			}
-		}
+	if r.Amount == 0 {
+		errors["amount"] = "amount cannot be zero"
+	}
 
-		if r.Amount < 0 {
-			errors["amount"] = "amount cannot be negative"
-		}
+	if r.Currency != "" {
+		validateCurrency(errors, "currency", r.Currency)
+	}
+
+	if r.Convert && r.Type != transferTransaction {
+		errors["convert"] = "only transfers can be converted"
+	}
 
-		if r.Amount == 0 {
-			errors["amount"] = "amount cannot be zero"
+	if r.ExecuteAt != nil {
+		if r.Type != transferTransaction {
+			errors["executeAt"] = "only transfers can be scheduled"
+		} else if !r.ExecuteAt.After(time.Now()) {
+			errors["executeAt"] = "execution time should be in the future"
 		}
 	}
 
-	if r.Type == depositTransaction {
+	return errors
+}
+
+func (r ReversalRequest) ValidateReversal() map[string]string {
+	errors := make(map[string]string)
+
+	if r.Amount < 0 {
+		errors["amount"] = "amount cannot be negative"
+	}
+
+	return errors
+}
+
+func (r HoldRequest) ValidateHold() map[string]string {
+	errors := make(map[string]string)
+
+	validateCardNumber(errors, "cardNumber", r.CardNumber)
+	validateExpireTime(errors, "cardExpireTime", r.CardExpireTime)
+	validateCVV(errors, "cvv", r.CVV)
+	validateCardNumber(errors, "merchantCardNumber", r.MerchantCardNumber)
+
+	if r.Amount <= 0 {
+		errors["amount"] = "amount should be positive"
+	}
+
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		errors["expiresAt"] = "expiration time should be in the future"
+	}
+
+	return errors
+}
+
+func (r CaptureRequest) ValidateCapture() map[string]string {
+	errors := make(map[string]string)
+
+	if r.Amount < 0 {
+		errors["amount"] = "amount cannot be negative"
+	}
+
+	return errors
+}
+
+func (r StandingOrderRequest) ValidateStandingOrder() map[string]string {
+	errors := make(map[string]string)
+
+	validateCardNumber(errors, "fromCardNumber", r.FromCardNumber)
+	validateCardNumber(errors, "toCardNumber", r.ToCardNumber)
+
+	if r.Amount <= 0 {
+		errors["amount"] = "amount should be positive"
+	}
+
+	if r.Currency != "" {
+		validateCurrency(errors, "currency", r.Currency)
+	}
+
+	if r.Frequency != frequencyDaily && r.Frequency != frequencyWeekly && r.Frequency != frequencyMonthly {
+		errors["frequency"] = "frequency should be daily, weekly or monthly"
+	}
+
+	if !r.StartAt.After(time.Now()) {
+		errors["startAt"] = "start time should be in the future"
+	}
+
+	if r.EndAt != nil && r.EndAt.Before(r.StartAt) {
+		errors["endAt"] = "end time should not be before start time"
+	}
+
+	if r.MaxRetries != nil && (*r.MaxRetries < 0 || *r.MaxRetries > maxStandingOrderRetries) {
+		errors["maxRetries"] = fmt.Sprintf("max retries should be between 0 and %d", maxStandingOrderRetries)
+	}
+
+	return errors
+}
+
+// ValidateStandingOrderUpdate validates the update against the order it
+// applies to, which starts at startAt.
+func (r StandingOrderUpdate) ValidateStandingOrderUpdate(startAt time.Time) map[string]string {
+	errors := make(map[string]string)
+
+	if r.Amount != nil && *r.Amount <= 0 {
+		errors["amount"] = "amount should be positive"
+	}
+
+	if r.EndAt != nil && !r.EndAt.After(time.Now()) {
+		errors["endAt"] = "end time should be in the future"
+	} else if r.EndAt != nil && r.EndAt.Before(startAt) {
+		errors["endAt"] = "end time should not be before start time"
+	}
+
+	return errors
+}
+
+func (l AccountLimits) ValidateLimits() map[string]string {
+	errors := make(map[string]string)
+
+	if l.TransactionLimit <= 0 {
+		errors["transactionLimit"] = "transaction limit should be positive"
+	}
+
+	if l.DailyLimit <= 0 {
+		errors["dailyLimit"] = "daily limit should be positive"
+	}
+
+	if l.DailyLimit < l.TransactionLimit {
+		errors["dailyLimit"] = "daily limit should not be less than transaction limit"
+	}
+
+	if l.DailyCountLimit <= 0 {
+		errors["dailyCountLimit"] = "daily count limit should be positive"
+	}
+
+	return errors
+}
+
+func (r OverdraftRequest) ValidateOverdraft() map[string]string {
+	errors := make(map[string]string)
+
+	if r.Limit < 0 {
+		errors["limit"] = "limit should not be negative"
+	}
+
+	return errors
+}
+
+func (r InterestRate) ValidateInterestRate() map[string]string {
+	errors := make(map[string]string)
+
+	if r.AnnualRateBps < 0 || r.AnnualRateBps > 10000 {
+		errors["annualRateBps"] = "annual rate should be between 0 and 10000 basis points"
+	}
+
+	return errors
+}
+
+func (r ExchangeRate) ValidateExchangeRate() map[string]string {
+	errors := make(map[string]string)
+
+	validateCurrency(errors, "base", r.Base)
+	validateCurrency(errors, "quote", r.Quote)
+
+	if r.Base == r.Quote {
+		errors["quote"] = "quote currency should differ from base currency"
+	}
+
+	whole, frac, _ := strings.Cut(r.Rate, ".")
+	switch {
+	case whole == "" || !isDigits(whole) || !isDigits(frac):
+		errors["rate"] = "rate should be a decimal number"
+	case len(whole) > maxRateWholeDigits || len(frac) > maxRateFractionalDigits:
+		errors["rate"] = fmt.Sprintf("rate should have at most %d whole and %d fractional digits", maxRateWholeDigits, maxRateFractionalDigits)
+	case strings.Trim(whole+frac, "0") == "":
+		errors["rate"] = "rate should be positive"
+	}
+
+	return errors
+}
+
+func (r NewAccountRequest) ValidateAccount() map[string]string {
+	errors := make(map[string]string)
+
+	if r.Type != checkingAccount && r.Type != savingsAccount {
+		errors["type"] = "account type should be checking or savings"
+	}
+
+	if r.Currency != "" {
+		validateCurrency(errors, "currency", r.Currency)
+	}
+
+	return errors
+}
 
-		if len(r.ToCardNumber) != 16 {
-			errors["toCardNumber"] = fmt.Sprintf("invalid card number: length should be 16, got %d", len(r.ToCardNumber))
+func (r NewCardRequest) ValidateCard() map[string]string {
+	errors := make(map[string]string)
+
+	if r.Kind != cardPhysical && r.Kind != cardVirtual {
+		errors["kind"] = "card kind should be physical or virtual"
+	}
+
+	return errors
+}
+
+func (r DetokenizeRequest) ValidateDetokenize() map[string]string {
+	errors := make(map[string]string)
+
+	validateCardToken(errors, "token", r.Token)
+
+	if len(r.Reason) == 0 {
+		errors["reason"] = "reason should not be empty"
+	}
+
+	return errors
+}
+
+func (r CardVerificationRequest) ValidateCardVerification() map[string]string {
+	errors := make(map[string]string)
+
+	validateCardNumber(errors, "cardNumber", r.CardNumber)
+	validateExpireTime(errors, "expireTime", r.ExpireTime)
+	validateCVV(errors, "cvv", r.CVV)
+
+	return errors
+}
+
+func validateExpireTime(errors map[string]string, field, expireTime string) {
+	if _, err := time.Parse(layout, expireTime); err != nil {
+		errors[field] = "expire time should be in MM/YY format"
+	}
+}
+
+func validateCVV(errors map[string]string, field, cvv string) {
+	if len(cvv) != 3 {
+		errors[field] = fmt.Sprintf("invalid cvv: length should be 3, got %d", len(cvv))
+	}
+
+	for _, digit := range cvv {
+		if !unicode.IsDigit(digit) {
+			errors[field] = "cvv should contains only digits"
+			break
 		}
+	}
+}
+
+// validateSource checks that one side of a transaction is given by exactly
+// one of card number, card token or account ID.
+func validateSource(errors map[string]string, side, cardNumber, cardToken string, accountID int) {
+	switch {
+	case accountID < 0:
+		errors[side+"AccountId"] = "account ID should be positive"
+	case accountID > 0 && (cardNumber != "" || cardToken != ""):
+		errors[side+"AccountId"] = fmt.Sprintf("use one of %sAccountId, %sCardNumber or %sCardToken", side, side, side)
+	case cardToken != "" && cardNumber != "":
+		errors[side+"CardToken"] = fmt.Sprintf("use either %sCardNumber or %sCardToken", side, side)
+	case cardToken != "":
+		validateCardToken(errors, side+"CardToken", cardToken)
+	case accountID == 0:
+		validateCardNumber(errors, side+"CardNumber", cardNumber)
+	}
+}
 
-		for _, digit := range r.ToCardNumber {
-			if !unicode.IsDigit(digit) {
-				errors["toCardNumber"] = "card number should contains only digits"
-				break
-			}
+// validateCurrency checks that the currency is an ISO 4217 alphabetic code.
+// Whether it is supported is up to the currencies table.
+func validateCurrency(errors map[string]string, field, currency string) {
+	if len(currency) != currencyCodeLength {
+		errors[field] = fmt.Sprintf("invalid currency: should be a %d-letter ISO 4217 code", currencyCodeLength)
+		return
+	}
+
+	for _, letter := range currency {
+		if letter < 'A' || letter > 'Z' {
+			errors[field] = "invalid currency: should contain only uppercase letters"
+			return
 		}
+	}
+}
+
+func validateCardToken(errors map[string]string, field, token string) {
+	if len(token) != cardNumberDigits {
+		errors[field] = fmt.Sprintf("invalid card token: length should be %d, got %d", cardNumberDigits, len(token))
+		return
+	}
 
-		if r.Amount < 0 {
-			errors["amount"] = "amount cannot be negative"
+	for _, digit := range token {
+		if !unicode.IsDigit(digit) {
+			errors[field] = "card token should contains only digits"
+			return
 		}
+	}
+
+	if luhnValid(token) {
+		errors[field] = "invalid card token: looks like a card number"
+	}
+}
 
-		if r.Amount == 0 {
-			errors["amount"] = "amount cannot be zero"
+func validateCardNumber(errors map[string]string, field, cardNumber string) {
+	if len(cardNumber) != cardNumberDigits {
+		errors[field] = fmt.Sprintf("invalid card number: length should be %d, got %d", cardNumberDigits, len(cardNumber))
+	}
+
+	for _, digit := range cardNumber {
+		if !unicode.IsDigit(digit) {
+			errors[field] = "card number should contains only digits"
+			return
 		}
 	}
 
-	return errors
+	if len(cardNumber) == cardNumberDigits && !luhnValid(cardNumber) {
+		errors[field] = invalidCheckDigit
+	}
 }
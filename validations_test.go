@@ -0,0 +1,270 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTransaction(t *testing.T) {
+	const (
+		card1 = "4000001234567899"
+		card2 = "4111111111111111"
+	)
+
+	var (
+		past   = time.Now().Add(-time.Hour)
+		future = time.Now().Add(time.Hour)
+	)
+
+	tests := []struct {
+		name           string
+		req            TransactionRequest
+		expectedFields []string
+	}{
+		{
+			name:           "Valid deposit",
+			req:            TransactionRequest{Type: depositTransaction, ToCardNumber: card1, Amount: 100},
+			expectedFields: nil,
+		},
+		{
+			name:           "Valid transfer",
+			req:            TransactionRequest{Type: transferTransaction, FromCardNumber: card1, ToCardNumber: card2, Amount: 100},
+			expectedFields: nil,
+		},
+		{
+			name:           "Valid withdrawal",
+			req:            TransactionRequest{Type: withdrawalTransaction, FromCardNumber: card1, Amount: 100},
+			expectedFields: nil,
+		},
+		{
+			name:           "Unsupported type",
+			req:            TransactionRequest{Type: "loan", Amount: 100},
+			expectedFields: []string{"transactionType"},
+		},
+		{
+			name:           "Withdrawal without card",
+			req:            TransactionRequest{Type: withdrawalTransaction, Amount: 100},
+			expectedFields: []string{"fromCardNumber"},
+		},
+		{
+			name:           "Transfer with letters and zero amount",
+			req:            TransactionRequest{Type: transferTransaction, FromCardNumber: "12345678abcdefgh", ToCardNumber: card2},
+			expectedFields: []string{"fromCardNumber", "amount"},
+		},
+		{
+			name:           "Scheduled transfer",
+			req:            TransactionRequest{Type: transferTransaction, FromCardNumber: card1, ToCardNumber: card2, Amount: 100, ExecuteAt: &future},
+			expectedFields: nil,
+		},
+		{
+			name:           "Scheduled transfer in the past",
+			req:            TransactionRequest{Type: transferTransaction, FromCardNumber: card1, ToCardNumber: card2, Amount: 100, ExecuteAt: &past},
+			expectedFields: []string{"executeAt"},
+		},
+		{
+			name:           "Scheduled deposit",
+			req:            TransactionRequest{Type: depositTransaction, ToCardNumber: card1, Amount: 100, ExecuteAt: &future},
+			expectedFields: []string{"executeAt"},
+		},
+		{
+			name:           "Deposit with negative amount",
+			req:            TransactionRequest{Type: depositTransaction, ToCardNumber: card1, Amount: -1},
+			expectedFields: []string{"amount"},
+		},
+		{
+			name:           "Transfer between accounts",
+			req:            TransactionRequest{Type: transferTransaction, FromAccountID: 1, ToAccountID: 2, Amount: 100},
+			expectedFields: nil,
+		},
+		{
+			name:           "Transfer from account to card",
+			req:            TransactionRequest{Type: transferTransaction, FromAccountID: 1, ToCardNumber: card2, Amount: 100},
+			expectedFields: nil,
+		},
+		{
+			name:           "Transfer with both account and card",
+			req:            TransactionRequest{Type: transferTransaction, FromAccountID: 1, FromCardNumber: card1, ToCardNumber: card2, Amount: 100},
+			expectedFields: []string{"fromAccountId"},
+		},
+		{
+			name:           "Transfer to card failing Luhn check",
+			req:            TransactionRequest{Type: transferTransaction, FromCardNumber: card1, ToCardNumber: "4111111111111112", Amount: 100},
+			expectedFields: []string{"toCardNumber"},
+		},
+		{
+			name:           "Transfer between card tokens",
+			req:            TransactionRequest{Type: transferTransaction, FromCardToken: "4000001234567898", ToCardToken: "4111111111111112", Amount: 100},
+			expectedFields: nil,
+		},
+		{
+			name:           "Transfer with both card number and token",
+			req:            TransactionRequest{Type: transferTransaction, FromCardNumber: card1, FromCardToken: "4000001234567898", ToCardNumber: card2, Amount: 100},
+			expectedFields: []string{"fromCardToken"},
+		},
+		{
+			name:           "Transfer with card number as token",
+			req:            TransactionRequest{Type: transferTransaction, FromCardNumber: card1, ToCardToken: card2, Amount: 100},
+			expectedFields: []string{"toCardToken"},
+		},
+		{
+			name:           "Deposit from card token",
+			req:            TransactionRequest{Type: depositTransaction, FromCardToken: "4000001234567898", ToCardNumber: card1, Amount: 100},
+			expectedFields: []string{"fromAccountId"},
+		},
+		{
+			name:           "Deposit from account",
+			req:            TransactionRequest{Type: depositTransaction, FromAccountID: 1, ToCardNumber: card1, Amount: 100},
+			expectedFields: []string{"fromAccountId"},
+		},
+		{
+			name:           "Converted transfer in euros",
+			req:            TransactionRequest{Type: transferTransaction, FromCardNumber: card1, ToCardNumber: card2, Amount: 100, Currency: "EUR", Convert: true},
+			expectedFields: nil,
+		},
+		{
+			name:           "Deposit with lowercase currency",
+			req:            TransactionRequest{Type: depositTransaction, ToCardNumber: card1, Amount: 100, Currency: "usd"},
+			expectedFields: []string{"currency"},
+		},
+		{
+			name:           "Converted withdrawal",
+			req:            TransactionRequest{Type: withdrawalTransaction, FromCardNumber: card1, Amount: 100, Currency: "USDT", Convert: true},
+			expectedFields: []string{"currency", "convert"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := tt.req.ValidateTransaction()
+			assert.Len(t, errors, len(tt.expectedFields))
+			for _, field := range tt.expectedFields {
+				assert.Contains(t, errors, field)
+			}
+		})
+	}
+}
+
+func TestValidateCardVerification(t *testing.T) {
+	tests := []struct {
+		name           string
+		req            CardVerificationRequest
+		expectedFields []string
+	}{
+		{
+			name:           "Valid",
+			req:            CardVerificationRequest{CardNumber: "4111111111111111", ExpireTime: "03/30", CVV: "123"},
+			expectedFields: nil,
+		},
+		{
+			name:           "Invalid expiry format",
+			req:            CardVerificationRequest{CardNumber: "4111111111111111", ExpireTime: "2030-03", CVV: "123"},
+			expectedFields: []string{"expireTime"},
+		},
+		{
+			name:           "Invalid everything",
+			req:            CardVerificationRequest{CardNumber: "4111111111111112", ExpireTime: "13/30", CVV: "1a"},
+			expectedFields: []string{"cardNumber", "expireTime", "cvv"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := tt.req.ValidateCardVerification()
+			assert.Len(t, errors, len(tt.expectedFields))
+			for _, field := range tt.expectedFields {
+				assert.Contains(t, errors, field)
+			}
+		})
+	}
+}
+
+func TestValidateStandingOrderUpdate(t *testing.T) {
+	startAt := time.Now().Add(time.Hour * 24 * 7)
+	beforeStart := startAt.Add(-time.Hour * 24)
+	afterStart := startAt.Add(time.Hour * 24)
+	past := time.Now().Add(-time.Hour)
+	zero := Money(0)
+
+	tests := []struct {
+		name           string
+		req            StandingOrderUpdate
+		expectedFields []string
+	}{
+		{
+			name:           "Valid",
+			req:            StandingOrderUpdate{EndAt: &afterStart},
+			expectedFields: nil,
+		},
+		{
+			name:           "End before start",
+			req:            StandingOrderUpdate{EndAt: &beforeStart},
+			expectedFields: []string{"endAt"},
+		},
+		{
+			name:           "Invalid everything",
+			req:            StandingOrderUpdate{Amount: &zero, EndAt: &past},
+			expectedFields: []string{"amount", "endAt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := tt.req.ValidateStandingOrderUpdate(startAt)
+			assert.Len(t, errors, len(tt.expectedFields))
+			for _, field := range tt.expectedFields {
+				assert.Contains(t, errors, field)
+			}
+		})
+	}
+}
+
+func TestValidateExchangeRate(t *testing.T) {
+	tests := []struct {
+		name           string
+		req            ExchangeRate
+		expectedFields []string
+	}{
+		{
+			name:           "Valid",
+			req:            ExchangeRate{Base: "USD", Quote: "EUR", Rate: "0.92345678"},
+			expectedFields: nil,
+		},
+		{
+			name:           "Whole rate",
+			req:            ExchangeRate{Base: "EUR", Quote: "USD", Rate: "1"},
+			expectedFields: nil,
+		},
+		{
+			name:           "Same currency",
+			req:            ExchangeRate{Base: "USD", Quote: "USD", Rate: "1"},
+			expectedFields: []string{"quote"},
+		},
+		{
+			name:           "Zero rate",
+			req:            ExchangeRate{Base: "USD", Quote: "EUR", Rate: "0.00"},
+			expectedFields: []string{"rate"},
+		},
+		{
+			name:           "Too precise rate",
+			req:            ExchangeRate{Base: "USD", Quote: "EUR", Rate: "0.923456789"},
+			expectedFields: []string{"rate"},
+		},
+		{
+			name:           "Invalid everything",
+			req:            ExchangeRate{Base: "us", Quote: "Eur", Rate: "-1"},
+			expectedFields: []string{"base", "quote", "rate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := tt.req.ValidateExchangeRate()
+			assert.Len(t, errors, len(tt.expectedFields))
+			for _, field := range tt.expectedFields {
+				assert.Contains(t, errors, field)
+			}
+		})
+	}
+}
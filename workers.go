@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	holdExpiryInterval         = time.Minute
+	scheduledTransferInterval  = time.Second * 30
+	scheduledTransferBatchSize = 100
+	standingOrderInterval      = time.Minute
+	standingOrderBatchSize     = 100
+	interestInterval           = time.Hour
+	cardReissueInterval        = time.Hour
+	cardReissueBatchSize       = 100
+	cardReissueWindow          = time.Hour * 24 * 30
+)
+
+// runHoldExpiry periodically marks pending holds past their expiration time
+// as expired. Expired holds stop reserving funds as soon as they expire; the
+// sweep only keeps their status accurate.
+func (s *Server) runHoldExpiry(ctx context.Context) {
+	ticker := time.NewTicker(holdExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.store.ExpireHolds(ctx); err != nil {
+				log.Printf("expire holds: %s", err)
+			}
+		}
+	}
+}
+
+func (s *Server) runScheduledTransfers(ctx context.Context) {
+	ticker := time.NewTicker(scheduledTransferInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.executeDueTransfers(ctx)
+		}
+	}
+}
+
+// executeDueTransfers runs every due scheduled transfer through Storer.Transfer.
+// Business failures such as insufficient funds are recorded on the transfer;
+// other errors leave it claimed so it is retried after the claim timeout.
+func (s *Server) executeDueTransfers(ctx context.Context) {
+	transfers, err := s.store.ClaimDueScheduledTransfers(ctx, scheduledTransferBatchSize)
+	if err != nil {
+		log.Printf("claim scheduled transfers: %s", err)
+		return
+	}
+
+	for i := range transfers {
+		scheduled := &transfers[i]
+
+		transaction, err := s.store.Transfer(ctx, &TransactionRequest{
+			Type:           transferTransaction,
+			FromCardNumber: scheduled.FromCardNumber,
+			ToCardNumber:   scheduled.ToCardNumber,
+			Amount:         scheduled.Amount,
+			Currency:       scheduled.Currency,
+			Convert:        scheduled.Convert,
+			UserID:         scheduled.UserID,
+			IdempotencyKey: "scheduled-transfer:" + scheduled.ID.String(),
+		})
+		if err != nil {
+			apiErr, ok := err.(APIError)
+			if !ok {
+				continue
+			}
+
+			scheduled.Status = scheduledFailed
+			scheduled.FailureReason = apiErr.Error()
+		} else {
+			scheduled.Status = scheduledExecuted
+			scheduled.TransactionID = &transaction.ID
+		}
+
+		if err := s.store.FinishScheduledTransfer(ctx, scheduled); err != nil {
+			log.Printf("finish scheduled transfer %s: %s", scheduled.ID, err)
+		}
+	}
+}
+
+func (s *Server) runStandingOrders(ctx context.Context) {
+	ticker := time.NewTicker(standingOrderInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.executeDueStandingOrders(ctx)
+		}
+	}
+}
+
+// executeDueStandingOrders materializes one run of every due standing order
+// through Storer.Transfer and records its outcome. Each occurrence has its
+// own idempotency key, so a retried or re-claimed run never transfers twice.
+func (s *Server) executeDueStandingOrders(ctx context.Context) {
+	orders, err := s.store.ClaimDueStandingOrders(ctx, standingOrderBatchSize)
+	if err != nil {
+		log.Printf("claim standing orders: %s", err)
+		return
+	}
+
+	for i := range orders {
+		order := &orders[i]
+
+		run := &StandingOrderRun{
+			StandingOrderID: order.ID,
+			ScheduledFor:    order.Occurrence(order.Period),
+			Attempt:         order.Attempts + 1,
+		}
+
+		transaction, err := s.store.Transfer(ctx, &TransactionRequest{
+			Type:           transferTransaction,
+			FromCardNumber: order.FromCardNumber,
+			ToCardNumber:   order.ToCardNumber,
+			Amount:         order.Amount,
+			Currency:       order.Currency,
+			Convert:        order.Convert,
+			UserID:         order.UserID,
+			IdempotencyKey: fmt.Sprintf("standing-order:%s:%d", order.ID, order.Period),
+		})
+		if err != nil {
+			apiErr, ok := err.(APIError)
+			if !ok {
+				continue
+			}
+
+			run.Status = runFailed
+			run.FailureReason = apiErr.Error()
+			order.Fail(time.Now())
+		} else {
+			run.Status = runExecuted
+			run.TransactionID = &transaction.ID
+			order.Succeed()
+		}
+
+		if err := s.store.RecordStandingOrderRun(ctx, order, run); err != nil {
+			log.Printf("record standing order %s run: %s", order.ID, err)
+		}
+	}
+}
+
+func (s *Server) runInterest(ctx context.Context) {
+	ticker := time.NewTicker(interestInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.accrueInterest(ctx)
+		}
+	}
+}
+
+// accrueInterest accrues interest for every day that has ended by the clock
+// and, once a month has ended, capitalizes the month's accruals. Days are
+// counted in UTC.
+func (s *Server) accrueInterest(ctx context.Context) {
+	year, month, day := s.clock.Now().UTC().Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	if err := s.store.AccrueInterest(ctx, today.AddDate(0, 0, -1)); err != nil {
+		return
+	}
+
+	s.store.CapitalizeInterest(ctx, time.Date(year, month, 1, 0, 0, 0, 0, time.UTC))
+}
+
+func (s *Server) runCardReissue(ctx context.Context) {
+	ticker := time.NewTicker(cardReissueInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reissueExpiringCards(ctx)
+		}
+	}
+}
+
+// reissueExpiringCards issues replacements for cards expiring within the
+// reissue window. Cards that fail are picked up again on the next tick.
+func (s *Server) reissueExpiringCards(ctx context.Context) {
+	cards, err := s.store.ExpiringCards(ctx, s.clock.Now().Add(cardReissueWindow), cardReissueBatchSize)
+	if err != nil {
+		log.Printf("get expiring cards: %s", err)
+		return
+	}
+
+	for _, card := range cards {
+		replacement := NewCard()
+		if err := s.store.ReissueCard(ctx, card.ID, &replacement); err != nil {
+			log.Printf("reissue card %d: %s", card.ID, err)
+		}
+	}
+}